@@ -0,0 +1,270 @@
+package norddrop
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/netip"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Reason an incoming transfer request was blocked
+type DenyReason string
+
+const (
+	// The peer address is not a valid IP address
+	DenyReasonInvalidPeer DenyReason = "invalid_peer"
+	// The peer matches the deny list
+	DenyReasonDenied DenyReason = "denied"
+	// The allow list is set and the peer does not match it
+	DenyReasonNotAllowed DenyReason = "not_allowed"
+	// The peer exceeded its incoming request rate
+	DenyReasonRateLimited DenyReason = "rate_limited"
+)
+
+// A single blocked transfer request
+type AccessDenial struct {
+	Time       time.Time  `json:"time"`
+	Peer       string     `json:"peer"`
+	TransferId string     `json:"transfer_id"`
+	Files      int        `json:"files"`
+	Reason     DenyReason `json:"reason"`
+	// Set when rejecting or finalizing the transfer failed
+	Error string `json:"error,omitempty"`
+}
+
+// Receives every blocked transfer request
+type AuditLog interface {
+	Record(denial AccessDenial)
+}
+
+type jsonAuditLog struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// Creates the audit log writing one JSON object per line
+func NewJSONAuditLog(w io.Writer) AuditLog {
+	return &jsonAuditLog{enc: json.NewEncoder(w)}
+}
+
+func (l *jsonAuditLog) Record(denial AccessDenial) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_ = l.enc.Encode(denial)
+}
+
+// Rules applied to incoming transfer requests
+type AccessPolicy struct {
+	// If not empty only peers within these networks are accepted
+	Allow []netip.Prefix
+	// Peers within these networks are always rejected. Takes precedence over
+	// `Allow`.
+	Deny []netip.Prefix
+	// Maximum number of requests accepted from a single peer within
+	// `RateWindow`. Zero disables the limit.
+	RateLimit int
+	// Rate limit window, one minute if zero
+	RateWindow time.Duration
+}
+
+// Parses CIDRs for `AccessPolicy`. Bare IP addresses are treated as single
+// host networks.
+func ParsePrefixes(cidrs ...string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		cidr = strings.TrimSpace(cidr)
+		if !strings.Contains(cidr, "/") {
+			addr, err := netip.ParseAddr(cidr)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// EventCallback decorator enforcing an `AccessPolicy`. Blocked
+// `EventKindRequestReceived` events never reach the wrapped callback: every
+// file is rejected with `RejectFile()` and the transfer is finalized. Any
+// further events of the blocked transfer are dropped as well.
+//
+// The instance needs to be attached with `Bind()` once the `NordDrop` is
+// created, since the callback is passed to `NewNordDrop()` before.
+type AccessControl struct {
+	next  EventCallback
+	audit AuditLog
+	drop  atomic.Pointer[NordDrop]
+
+	mu       sync.Mutex
+	policy   AccessPolicy
+	blocked  map[string]struct{}
+	requests map[netip.Addr][]time.Time
+}
+
+// # Arguments
+// * `next` - Callback receiving the events of accepted transfers
+// * `policy` - Initial policy
+// * `audit` - Blocked request sink, may be `nil`
+func NewAccessControl(next EventCallback, policy AccessPolicy, audit AuditLog) *AccessControl {
+	return &AccessControl{
+		next:     next,
+		audit:    audit,
+		policy:   policy,
+		blocked:  map[string]struct{}{},
+		requests: map[netip.Addr][]time.Time{},
+	}
+}
+
+// Attaches the instance used to reject blocked transfers
+func (ac *AccessControl) Bind(drop *NordDrop) {
+	ac.drop.Store(drop)
+}
+
+func (ac *AccessControl) wrapped() []any {
+	return []any{ac.next}
+}
+
+// Replaces the policy. Applies to requests received afterwards.
+func (ac *AccessControl) SetPolicy(policy AccessPolicy) {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	ac.policy = policy
+}
+
+func (ac *AccessControl) OnEvent(event Event) {
+	if req, ok := event.Kind.(EventKindRequestReceived); ok {
+		if reason, blocked := ac.check(req.Peer); blocked {
+			ac.block(req, reason)
+			return
+		}
+		ac.next.OnEvent(event)
+		return
+	}
+
+	if transferId, ok := eventTransferId(event.Kind); ok {
+		ac.mu.Lock()
+		_, blocked := ac.blocked[transferId]
+		if blocked {
+			if _, finalized := event.Kind.(EventKindTransferFinalized); finalized {
+				delete(ac.blocked, transferId)
+			}
+		}
+		ac.mu.Unlock()
+		if blocked {
+			return
+		}
+	}
+	ac.next.OnEvent(event)
+}
+
+func (ac *AccessControl) check(peer string) (DenyReason, bool) {
+	addr, err := netip.ParseAddr(strings.Trim(peer, "[]"))
+	if err != nil {
+		return DenyReasonInvalidPeer, true
+	}
+	addr = addr.Unmap().WithZone("")
+
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+
+	if prefixesContain(ac.policy.Deny, addr) {
+		return DenyReasonDenied, true
+	}
+	if len(ac.policy.Allow) > 0 && !prefixesContain(ac.policy.Allow, addr) {
+		return DenyReasonNotAllowed, true
+	}
+	if ac.policy.RateLimit > 0 && !ac.allowRequest(addr, time.Now()) {
+		return DenyReasonRateLimited, true
+	}
+	return "", false
+}
+
+// Sliding window limiter, needs `ac.mu` held
+func (ac *AccessControl) allowRequest(addr netip.Addr, now time.Time) bool {
+	window := ac.policy.RateWindow
+	if window <= 0 {
+		window = time.Minute
+	}
+	cutoff := now.Add(-window)
+
+	for peer, times := range ac.requests {
+		if len(times) == 0 || !times[len(times)-1].After(cutoff) {
+			delete(ac.requests, peer)
+		}
+	}
+
+	times := ac.requests[addr]
+	i := 0
+	for i < len(times) && !times[i].After(cutoff) {
+		i++
+	}
+	times = times[i:]
+	if len(times) >= ac.policy.RateLimit {
+		ac.requests[addr] = times
+		return false
+	}
+	ac.requests[addr] = append(times, now)
+	return true
+}
+
+func prefixesContain(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func (ac *AccessControl) block(req EventKindRequestReceived, reason DenyReason) {
+	ac.mu.Lock()
+	ac.blocked[req.TransferId] = struct{}{}
+	ac.mu.Unlock()
+
+	denial := AccessDenial{
+		Time:       time.Now(),
+		Peer:       req.Peer,
+		TransferId: req.TransferId,
+		Files:      len(req.Files),
+		Reason:     reason,
+	}
+
+	// Calling back into libdrop from its own event thread is avoided
+	go func() {
+		if err := ac.reject(req); err != nil {
+			denial.Error = err.Error()
+		}
+		if ac.audit != nil {
+			ac.audit.Record(denial)
+		}
+	}()
+}
+
+func (ac *AccessControl) reject(req EventKindRequestReceived) error {
+	drop := ac.drop.Load()
+	if drop == nil {
+		return fmt.Errorf("AccessControl is not bound to a NordDrop instance")
+	}
+
+	var firstErr error
+	for _, file := range req.Files {
+		if err := drop.RejectFile(req.TransferId, file.Id); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if err := drop.FinalizeTransfer(req.TransferId); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	return firstErr
+}
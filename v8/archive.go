@@ -0,0 +1,434 @@
+package norddrop
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Err* are used for checking error type with `errors.Is`
+var ErrArchiveTraversal = fmt.Errorf("ArchiveTraversal")
+
+// Compression applied to directory archives. gzip and zstd are built in,
+// others are added with `RegisterArchiveCodec()`.
+type ArchiveCodec struct {
+	Name string
+	// Extension following `.tar`, e.g. `.gz`
+	Extension string
+	// Leading bytes identifying compressed streams
+	Magic      []byte
+	Compress   func(w io.Writer) (io.WriteCloser, error)
+	Decompress func(r io.Reader) (io.ReadCloser, error)
+}
+
+var ArchiveGzip = &ArchiveCodec{
+	Name:      "gzip",
+	Extension: ".gz",
+	Magic:     []byte{0x1f, 0x8b},
+	Compress: func(w io.Writer) (io.WriteCloser, error) {
+		return gzip.NewWriter(w), nil
+	},
+	Decompress: func(r io.Reader) (io.ReadCloser, error) {
+		return gzip.NewReader(r)
+	},
+}
+
+var ArchiveZstd = &ArchiveCodec{
+	Name:      "zstd",
+	Extension: ".zst",
+	Magic:     []byte{0x28, 0xb5, 0x2f, 0xfd},
+	Compress: func(w io.Writer) (io.WriteCloser, error) {
+		return zstd.NewWriter(w)
+	},
+	Decompress: func(r io.Reader) (io.ReadCloser, error) {
+		d, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	},
+}
+
+var (
+	archiveCodecsMu sync.RWMutex
+	archiveCodecs   = []*ArchiveCodec{ArchiveGzip, ArchiveZstd}
+)
+
+// Makes `UnpackArchive()` and `ArchiveUnpacker` recognize the codec
+func RegisterArchiveCodec(codec *ArchiveCodec) {
+	archiveCodecsMu.Lock()
+	defer archiveCodecsMu.Unlock()
+	archiveCodecs = append(archiveCodecs, codec)
+}
+
+// Returns the codec matching the stream's leading bytes, `nil` for plain
+// tar
+func detectArchiveCodec(head []byte) *ArchiveCodec {
+	archiveCodecsMu.RLock()
+	defer archiveCodecsMu.RUnlock()
+	for _, codec := range archiveCodecs {
+		if len(codec.Magic) > 0 && bytes.HasPrefix(head, codec.Magic) {
+			return codec
+		}
+	}
+	return nil
+}
+
+// Returns the archive extension of the file name, `.tar` or `.tar` followed
+// by a registered codec extension, and "" for other files
+func archiveExtension(name string) string {
+	lower := strings.ToLower(name)
+	archiveCodecsMu.RLock()
+	defer archiveCodecsMu.RUnlock()
+	for _, codec := range archiveCodecs {
+		if ext := ".tar" + codec.Extension; strings.HasSuffix(lower, ext) {
+			return name[len(name)-len(ext):]
+		}
+	}
+	if strings.HasSuffix(lower, ".tar") {
+		return name[len(name)-len(".tar"):]
+	}
+	return ""
+}
+
+// Writes `dir` as a tar stream with entries under the directory's base
+// name. Regular files, directories and symlinks are included, other file
+// types are skipped.
+func WriteArchive(w io.Writer, dir string, codec *ArchiveCodec) error {
+	out := w
+	var compressor io.WriteCloser
+	if codec != nil {
+		var err error
+		if compressor, err = codec.Compress(w); err != nil {
+			return err
+		}
+		out = compressor
+	}
+
+	root := filepath.Base(filepath.Clean(dir))
+	tw := tar.NewWriter(out)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		var link string
+		switch {
+		case info.Mode().IsRegular(), info.IsDir():
+		case info.Mode()&fs.ModeSymlink != 0:
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		default:
+			return nil
+		}
+
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(filepath.Join(root, rel))
+		if info.IsDir() {
+			hdr.Name += "/"
+		}
+		hdr.Uname, hdr.Gname = "", ""
+		hdr.Uid, hdr.Gid = 0, 0
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("archiving %s: %w", dir, err)
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if compressor != nil {
+		return compressor.Close()
+	}
+	return nil
+}
+
+// Extracts the tar archive, compressed with any registered codec, into
+// `dest`. Entries with absolute paths or leaving `dest` fail the whole
+// extraction with `ErrArchiveTraversal`, as do symlinks pointing outside of
+// it, directly or through other symlinks of the archive. Symlinks are
+// created after all files so no file is written through one. Hard links and
+// special files are skipped.
+func UnpackArchive(archive string, dest string) error {
+	f, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	head, _ := br.Peek(8)
+	var in io.Reader = br
+	if codec := detectArchiveCodec(head); codec != nil {
+		rc, err := codec.Decompress(br)
+		if err != nil {
+			return fmt.Errorf("decompressing %s: %w", archive, err)
+		}
+		defer rc.Close()
+		in = rc
+	}
+
+	if err := os.MkdirAll(dest, 0o755); err != nil {
+		return err
+	}
+
+	type symlink struct{ path, target string }
+	var symlinks []symlink
+
+	tr := tar.NewReader(in)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", archive, err)
+		}
+
+		target, err := archiveEntryPath(dest, hdr.Name)
+		if err != nil {
+			return err
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0o755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := unpackFile(tr, target, hdr.FileInfo().Mode().Perm()); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			resolved := hdr.Linkname
+			if !path.IsAbs(resolved) {
+				resolved = path.Join(path.Dir(hdr.Name), resolved)
+			}
+			if _, err := archiveEntryPath(dest, resolved); err != nil || path.IsAbs(hdr.Linkname) {
+				return fmt.Errorf("%w: symlink %s points to %s", ErrArchiveTraversal, hdr.Name, hdr.Linkname)
+			}
+			symlinks = append(symlinks, symlink{target, hdr.Linkname})
+		}
+	}
+
+	// Targets are checked as text above, but symlinks created earlier may
+	// redirect later ones, so both the parent of each symlink and where it
+	// finally points to are checked on disk
+	realDest, err := filepath.EvalSymlinks(dest)
+	if err != nil {
+		return err
+	}
+	for _, link := range symlinks {
+		if err := resolvesInside(realDest, filepath.Dir(link.path)); err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(link.path), 0o755); err != nil {
+			return err
+		}
+		if err := os.Symlink(filepath.FromSlash(link.target), link.path); err != nil {
+			return err
+		}
+	}
+	for _, link := range symlinks {
+		// Dangling symlinks and loops can't be followed, skip them
+		if resolved, err := filepath.EvalSymlinks(link.path); err == nil && !pathInside(realDest, resolved) {
+			return fmt.Errorf("%w: symlink %s resolves to %s", ErrArchiveTraversal, link.path, resolved)
+		}
+	}
+	return nil
+}
+
+// Fails with `ErrArchiveTraversal` unless the deepest existing ancestor of
+// `p`, symlinks resolved, is inside `root`. `root` must be resolved already.
+func resolvesInside(root string, p string) error {
+	for {
+		resolved, err := filepath.EvalSymlinks(p)
+		if err == nil {
+			if !pathInside(root, resolved) {
+				return fmt.Errorf("%w: %s resolves to %s", ErrArchiveTraversal, p, resolved)
+			}
+			return nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) || filepath.Dir(p) == p {
+			return err
+		}
+		p = filepath.Dir(p)
+	}
+}
+
+func pathInside(root string, p string) bool {
+	rel, err := filepath.Rel(root, p)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func archiveEntryPath(dest string, name string) (string, error) {
+	if path.IsAbs(name) || filepath.IsAbs(name) || filepath.VolumeName(name) != "" {
+		return "", fmt.Errorf("%w: absolute entry %s", ErrArchiveTraversal, name)
+	}
+	clean := path.Clean(name)
+	if clean == ".." || strings.HasPrefix(clean, "../") || strings.Contains(name, `\`) {
+		return "", fmt.Errorf("%w: entry %s leaves the destination", ErrArchiveTraversal, name)
+	}
+	return filepath.Join(dest, filepath.FromSlash(clean)), nil
+}
+
+func unpackFile(r io.Reader, target string, perm fs.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm|0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// EventCallback decorator unpacking downloaded archives, recognized by
+// their `.tar` extension, next to the download. `foo.tar.gz` is unpacked
+// into the directory `foo`, or `foo (1)` and so on if it exists.
+type ArchiveUnpacker struct {
+	next          EventCallback
+	removeArchive bool
+	onDone        func(archive string, dir string, err error)
+}
+
+// # Arguments
+// * `next` - Callback receiving all events, may be `nil`
+// * `removeArchive` - Delete the archive after successful unpacking
+// * `onDone` - Called from a separate goroutine once unpacking finished, may be `nil`
+func NewArchiveUnpacker(next EventCallback, removeArchive bool, onDone func(archive string, dir string, err error)) *ArchiveUnpacker {
+	return &ArchiveUnpacker{next: next, removeArchive: removeArchive, onDone: onDone}
+}
+
+func (u *ArchiveUnpacker) wrapped() []any {
+	return []any{u.next}
+}
+
+func (u *ArchiveUnpacker) OnEvent(event Event) {
+	if k, ok := event.Kind.(EventKindFileDownloaded); ok {
+		if ext := archiveExtension(k.FinalPath); ext != "" {
+			go u.unpack(k.FinalPath, ext)
+		}
+	}
+	if u.next != nil {
+		u.next.OnEvent(event)
+	}
+}
+
+func (u *ArchiveUnpacker) unpack(archive string, ext string) {
+	dir, err := unpackNextTo(archive, ext, u.removeArchive)
+	if u.onDone != nil {
+		u.onDone(archive, dir, err)
+	}
+}
+
+// Unpacks the archive into an unused directory next to it named after the
+// archive without `ext`
+func unpackNextTo(archive string, ext string, removeArchive bool) (string, error) {
+	dir, err := unusedPath(strings.TrimSuffix(archive, ext))
+	if err != nil {
+		return "", err
+	}
+	if err := unpackInto(archive, dir, removeArchive); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// Unpacks the archive into `dir`, which must not exist
+func unpackInto(archive string, dir string, removeArchive bool) error {
+	// The archive nests its entries under the sent directory's name, unpack
+	// next to it and move that directory into place
+	tmp, err := os.MkdirTemp(filepath.Dir(archive), ".unpack-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	if err := UnpackArchive(archive, tmp); err != nil {
+		return err
+	}
+	if err := moveUnpackedRoot(tmp, dir); err != nil {
+		return err
+	}
+	if removeArchive {
+		return os.Remove(archive)
+	}
+	return nil
+}
+
+// Moves the single top level directory of `tmp` to `dir`, or `tmp`'s whole
+// content when the archive has several top level entries
+func moveUnpackedRoot(tmp string, dir string) error {
+	entries, err := os.ReadDir(tmp)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 1 && entries[0].IsDir() {
+		return os.Rename(filepath.Join(tmp, entries[0].Name()), dir)
+	}
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := os.Rename(filepath.Join(tmp, entry.Name()), filepath.Join(dir, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func unusedPath(base string) (string, error) {
+	for i := 0; i < 1000; i++ {
+		candidate := base
+		if i > 0 {
+			candidate = fmt.Sprintf("%s (%d)", base, i)
+		}
+		if _, err := os.Lstat(candidate); os.IsNotExist(err) {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("no unused name for %s", base)
+}
@@ -0,0 +1,93 @@
+package norddrop
+
+import (
+	"archive/tar"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTestArchive(t *testing.T, path string, symlinks [][2]string) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tw := tar.NewWriter(f)
+	for _, link := range symlinks {
+		hdr := &tar.Header{Typeflag: tar.TypeSymlink, Name: link[0], Linkname: link[1], Mode: 0o777}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUnpackArchiveSymlinkChain(t *testing.T) {
+	tests := map[string][][2]string{
+		"parent": {{"a/b", ".."}, {"a/b/c", ".."}, {"a/b/c/pwned", "x"}},
+		"target": {{"s", "."}, {"l", "s/.."}},
+	}
+	for name, symlinks := range tests {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			archive := filepath.Join(dir, "evil.tar")
+			writeTestArchive(t, archive, symlinks)
+
+			dest := filepath.Join(dir, "dest")
+			if err := UnpackArchive(archive, dest); !errors.Is(err, ErrArchiveTraversal) {
+				t.Errorf("UnpackArchive() = %v, want ErrArchiveTraversal", err)
+			}
+			if _, err := os.Lstat(filepath.Join(dir, "pwned")); !os.IsNotExist(err) {
+				t.Errorf("symlink created outside of the destination: %v", err)
+			}
+		})
+	}
+}
+
+func TestUnpackArchiveSymlinkInside(t *testing.T) {
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "ok.tar")
+	writeTestArchive(t, archive, [][2]string{{"a/b", ".."}, {"a/c", "b/a"}})
+
+	if err := UnpackArchive(archive, filepath.Join(dir, "dest")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestArchiveCodecRoundTrip(t *testing.T) {
+	for _, codec := range []*ArchiveCodec{nil, ArchiveGzip, ArchiveZstd} {
+		dir := t.TempDir()
+		tree := filepath.Join(dir, "tree")
+		writeTestFile(t, filepath.Join(tree, "sub", "a.txt"), "a")
+
+		name := "tree.tar"
+		if codec != nil {
+			name += codec.Extension
+		}
+		archive := filepath.Join(dir, name)
+		f, err := os.Create(archive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := WriteArchive(f, tree, codec); err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+
+		if ext := archiveExtension(name); ext != name[len("tree"):] {
+			t.Errorf("archiveExtension(%s) = %s", name, ext)
+		}
+		dest := filepath.Join(dir, "dest")
+		if err := UnpackArchive(archive, dest); err != nil {
+			t.Fatal(err)
+		}
+		if data, _ := os.ReadFile(filepath.Join(dest, "tree", "sub", "a.txt")); string(data) != "a" {
+			t.Errorf("%s: a.txt holds %q", name, data)
+		}
+	}
+}
@@ -0,0 +1,326 @@
+package norddrop
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Prefix of the environment variables overriding configuration keys, e.g.
+// `NORDDROP_STORAGE_PATH` for `storage_path`
+const ConfigEnvPrefix = "NORDDROP_"
+
+// Returns the defaults used for keys missing from configuration files:
+//
+//	dir_depth_limit                 5
+//	transfer_file_limit             1000
+//	moose_event_path                ""
+//	moose_prod                      false
+//	storage_path                    ":memory:" (no persistence)
+//	checksum_events_size_threshold  null (no checksum events)
+//	checksum_events_granularity     null (libdrop default)
+//	connection_retries              null (libdrop default of 5)
+//	auto_retry_interval_ms          null (no automatic retries)
+func DefaultConfig() Config {
+	return Config{
+		DirDepthLimit:     5,
+		TransferFileLimit: 1000,
+		StoragePath:       InMemoryStorage,
+	}
+}
+
+// Invalid value of a configuration key
+type ConfigKeyError struct {
+	Key string
+	// File or environment variable the value came from
+	Source string
+	Err    error
+}
+
+func (e *ConfigKeyError) Error() string {
+	if e.Source != "" {
+		return fmt.Sprintf("config key %q (%s): %v", e.Key, e.Source, e.Err)
+	}
+	return fmt.Sprintf("config key %q: %v", e.Key, e.Err)
+}
+
+func (e *ConfigKeyError) Unwrap() error {
+	return e.Err
+}
+
+type configKey struct {
+	name string
+	set  func(config *Config, value any) error
+}
+
+var configKeys = []configKey{
+	{"dir_depth_limit", func(c *Config, v any) error { return setConfigUint64(&c.DirDepthLimit, v) }},
+	{"transfer_file_limit", func(c *Config, v any) error { return setConfigUint64(&c.TransferFileLimit, v) }},
+	{"moose_event_path", func(c *Config, v any) error { return setConfigString(&c.MooseEventPath, v) }},
+	{"moose_prod", func(c *Config, v any) error { return setConfigBool(&c.MooseProd, v) }},
+	{"storage_path", func(c *Config, v any) error { return setConfigString(&c.StoragePath, v) }},
+	{"checksum_events_size_threshold", func(c *Config, v any) error {
+		return setConfigOptional(&c.ChecksumEventsSizeThreshold, v, math.MaxUint64)
+	}},
+	{"checksum_events_granularity", func(c *Config, v any) error {
+		return setConfigOptional(&c.ChecksumEventsGranularity, v, math.MaxUint64)
+	}},
+	{"connection_retries", func(c *Config, v any) error {
+		return setConfigOptional(&c.ConnectionRetries, v, math.MaxUint32)
+	}},
+	{"auto_retry_interval_ms", func(c *Config, v any) error {
+		return setConfigOptional(&c.AutoRetryIntervalMs, v, math.MaxUint32)
+	}},
+}
+
+// Loads the configuration file, picking the format by its extension
+// (`.yaml`, `.yml`, `.json` or `.toml`), and applies the environment
+// overrides, see `ApplyConfigEnv()`
+func LoadConfig(path string) (Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Config{}, err
+	}
+	defer f.Close()
+
+	var config Config
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		config, err = loadConfig(f, path, decodeYAML)
+	case ".json":
+		config, err = loadConfig(f, path, decodeJSON)
+	case ".toml":
+		config, err = loadConfig(f, path, decodeTOML)
+	default:
+		return Config{}, fmt.Errorf("unsupported config format %q", filepath.Ext(path))
+	}
+	if err != nil {
+		return Config{}, err
+	}
+	if err := ApplyConfigEnv(&config); err != nil {
+		return Config{}, err
+	}
+	return config, nil
+}
+
+// Loads YAML configuration on top of `DefaultConfig()`. Keys are the
+// snake case field names, `null` leaves optional fields unset.
+func LoadConfigYAML(r io.Reader) (Config, error) {
+	return loadConfig(r, "", decodeYAML)
+}
+
+// Loads JSON configuration on top of `DefaultConfig()`, see
+// `LoadConfigYAML()`
+func LoadConfigJSON(r io.Reader) (Config, error) {
+	return loadConfig(r, "", decodeJSON)
+}
+
+// Loads TOML configuration on top of `DefaultConfig()`, see
+// `LoadConfigYAML()`. TOML has no null, optional fields are left unset by
+// omitting them.
+func LoadConfigTOML(r io.Reader) (Config, error) {
+	return loadConfig(r, "", decodeTOML)
+}
+
+func decodeYAML(r io.Reader) (map[string]any, error) {
+	values := map[string]any{}
+	if err := yaml.NewDecoder(r).Decode(&values); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return values, nil
+}
+
+func decodeJSON(r io.Reader) (map[string]any, error) {
+	values := map[string]any{}
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	if err := dec.Decode(&values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+func decodeTOML(r io.Reader) (map[string]any, error) {
+	values := map[string]any{}
+	if _, err := toml.NewDecoder(r).Decode(&values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+func loadConfig(r io.Reader, source string, decode func(io.Reader) (map[string]any, error)) (Config, error) {
+	values, err := decode(r)
+	if err != nil {
+		if source != "" {
+			return Config{}, fmt.Errorf("parsing %s: %w", source, err)
+		}
+		return Config{}, err
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	config := DefaultConfig()
+	for _, name := range names {
+		key, ok := findConfigKey(name)
+		if !ok {
+			return Config{}, &ConfigKeyError{Key: name, Source: source, Err: fmt.Errorf("unknown key")}
+		}
+		if err := key.set(&config, values[name]); err != nil {
+			return Config{}, &ConfigKeyError{Key: name, Source: source, Err: err}
+		}
+	}
+	return config, nil
+}
+
+func findConfigKey(name string) (configKey, bool) {
+	for _, key := range configKeys {
+		if key.name == name {
+			return key, true
+		}
+	}
+	return configKey{}, false
+}
+
+// Overrides configuration keys with the `NORDDROP_` prefixed upper case
+// environment variables, e.g. `NORDDROP_CONNECTION_RETRIES=3`. An empty
+// value or `null` unsets optional fields.
+func ApplyConfigEnv(config *Config) error {
+	for _, key := range configKeys {
+		env := ConfigEnvPrefix + strings.ToUpper(key.name)
+		value, ok := os.LookupEnv(env)
+		if !ok {
+			continue
+		}
+		var v any = value
+		if value == "" || value == "null" {
+			v = nil
+		}
+		if err := key.set(config, v); err != nil {
+			return &ConfigKeyError{Key: key.name, Source: env, Err: err}
+		}
+	}
+	return nil
+}
+
+func setConfigString(field *string, value any) error {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case string:
+		*field = v
+		return nil
+	default:
+		return fmt.Errorf("expected a string, got %v", describeConfigValue(value))
+	}
+}
+
+func setConfigBool(field *bool, value any) error {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case bool:
+		*field = v
+		return nil
+	case string:
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("expected a boolean, got %q", v)
+		}
+		*field = b
+		return nil
+	default:
+		return fmt.Errorf("expected a boolean, got %v", describeConfigValue(value))
+	}
+}
+
+func setConfigUint64(field *uint64, value any) error {
+	if value == nil {
+		return nil
+	}
+	n, err := configUint(value, math.MaxUint64)
+	if err != nil {
+		return err
+	}
+	*field = n
+	return nil
+}
+
+// `nil` unsets the field
+func setConfigOptional[T uint32 | uint64](field **T, value any, max uint64) error {
+	if value == nil {
+		*field = nil
+		return nil
+	}
+	n, err := configUint(value, max)
+	if err != nil {
+		return err
+	}
+	v := T(n)
+	*field = &v
+	return nil
+}
+
+func configUint(value any, max uint64) (uint64, error) {
+	var n uint64
+	switch v := value.(type) {
+	case int:
+		if v < 0 {
+			return 0, fmt.Errorf("expected a non-negative integer, got %d", v)
+		}
+		n = uint64(v)
+	case int64:
+		if v < 0 {
+			return 0, fmt.Errorf("expected a non-negative integer, got %d", v)
+		}
+		n = uint64(v)
+	case uint64:
+		n = v
+	case float64:
+		if v < 0 || v != math.Trunc(v) || v > float64(max) {
+			return 0, fmt.Errorf("expected a non-negative integer, got %v", v)
+		}
+		n = uint64(v)
+	case json.Number:
+		return configUint(v.String(), max)
+	case string:
+		parsed, err := strconv.ParseUint(strings.TrimSpace(v), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("expected a non-negative integer, got %q", v)
+		}
+		n = parsed
+	default:
+		return 0, fmt.Errorf("expected a non-negative integer, got %v", describeConfigValue(value))
+	}
+	if n > max {
+		return 0, fmt.Errorf("%d is out of range, maximum is %d", n, max)
+	}
+	return n, nil
+}
+
+func describeConfigValue(value any) string {
+	switch value.(type) {
+	case map[string]any:
+		return "a table"
+	case []any, []map[string]any:
+		return "a list"
+	}
+	var b bytes.Buffer
+	if err := json.NewEncoder(&b).Encode(value); err != nil {
+		return fmt.Sprintf("%T", value)
+	}
+	return strings.TrimSpace(b.String())
+}
@@ -0,0 +1,191 @@
+package norddrop
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Largest `ChecksumEventsGranularity` accepted by `Config.Validate()`,
+// anything coarser exceeds any plausible file size
+const MaxChecksumEventsGranularity = 1 << 40
+
+// StoragePath disabling persistence
+const InMemoryStorage = ":memory:"
+
+// Invalid value of a single field, the field name matches the `Config`
+// field or is `addr` for the listen address
+type FieldError struct {
+	Field string
+	Value any
+	Err   error
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s (%v): %v", e.Field, e.Value, e.Err)
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// All problems found by a validation, each usually a `*FieldError`
+type ValidationErrors []error
+
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return "invalid configuration: " + strings.Join(msgs, "; ")
+}
+
+func (e ValidationErrors) Unwrap() []error {
+	return e
+}
+
+// Returns the errors of the named field
+func (e ValidationErrors) Field(name string) []error {
+	var errs []error
+	for _, err := range e {
+		var fieldErr *FieldError
+		if errors.As(err, &fieldErr) && fieldErr.Field == name {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+type validation struct {
+	errs ValidationErrors
+}
+
+func (v *validation) fail(field string, value any, format string, args ...any) {
+	v.errs = append(v.errs, &FieldError{Field: field, Value: value, Err: fmt.Errorf(format, args...)})
+}
+
+func (v *validation) failErr(field string, value any, err error) {
+	v.errs = append(v.errs, &FieldError{Field: field, Value: value, Err: err})
+}
+
+func (v *validation) err() error {
+	if len(v.errs) == 0 {
+		return nil
+	}
+	return v.errs
+}
+
+// Checks the values libdrop rejects only with an opaque
+// `LibdropErrorInstanceStart`, including whether the storage and moose
+// paths can be created. Settings which merely have no effect, such as a
+// checksum granularity without a threshold, are not reported. Returns
+// `ValidationErrors` listing every problem.
+func (c Config) Validate() error {
+	var v validation
+	c.validate(&v)
+	return v.err()
+}
+
+func (c Config) validate(v *validation) {
+	if c.DirDepthLimit == 0 {
+		v.fail("DirDepthLimit", c.DirDepthLimit, "must be at least 1")
+	}
+	if c.TransferFileLimit == 0 {
+		v.fail("TransferFileLimit", c.TransferFileLimit, "must be at least 1")
+	}
+
+	switch c.StoragePath {
+	case "":
+		v.fail("StoragePath", c.StoragePath, "must not be empty, use %q to disable persistence", InMemoryStorage)
+	case InMemoryStorage:
+	default:
+		if err := checkWritableFile(c.StoragePath); err != nil {
+			v.failErr("StoragePath", c.StoragePath, err)
+		}
+	}
+	if c.MooseEventPath != "" && c.MooseEventPath != InMemoryStorage {
+		if err := checkWritableFile(c.MooseEventPath); err != nil {
+			v.failErr("MooseEventPath", c.MooseEventPath, err)
+		}
+	}
+
+	if g := c.ChecksumEventsGranularity; g != nil && (*g == 0 || *g > MaxChecksumEventsGranularity) {
+		v.fail("ChecksumEventsGranularity", *g, "must be between 1 and %d bytes", uint64(MaxChecksumEventsGranularity))
+	}
+	if i := c.AutoRetryIntervalMs; i != nil && *i == 0 {
+		v.fail("AutoRetryIntervalMs", *i, "must be positive, leave it unset to disable automatic retries")
+	}
+}
+
+// The file must either be writable or creatable in an existing writable
+// directory
+func checkWritableFile(path string) error {
+	info, err := os.Stat(path)
+	if err == nil {
+		if !info.Mode().IsRegular() {
+			return fmt.Errorf("not a regular file")
+		}
+		f, err := os.OpenFile(path, os.O_WRONLY, 0)
+		if err != nil {
+			return err
+		}
+		return f.Close()
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	dir := filepath.Dir(path)
+	info, err = os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("directory %s: %w", dir, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	probe, err := os.CreateTemp(dir, ".norddrop-probe-*")
+	if err != nil {
+		return fmt.Errorf("directory %s is not writable: %w", dir, err)
+	}
+	probe.Close()
+	return os.Remove(probe.Name())
+}
+
+// Checks the address passed to `NordDrop.Start()`: an IPv4 or IPv6 address
+// without a port, libdrop always listens on its own port
+func ValidateListenAddr(addr string) error {
+	var v validation
+	validateListenAddr(&v, addr)
+	return v.err()
+}
+
+func validateListenAddr(v *validation, addr string) {
+	if addr == "" {
+		v.fail("addr", addr, "must not be empty")
+		return
+	}
+	ip, err := netip.ParseAddr(addr)
+	if err == nil {
+		if ip.IsMulticast() {
+			v.fail("addr", addr, "must not be a multicast address")
+		}
+		return
+	}
+	if _, perr := netip.ParseAddrPort(addr); perr == nil {
+		v.fail("addr", addr, "must not include a port")
+		return
+	}
+	v.fail("addr", addr, "must be an IP address, host names are not resolved")
+}
+
+// Validates both arguments of `NordDrop.Start()`, reporting all problems at
+// once
+func ValidateStart(addr string, config Config) error {
+	var v validation
+	validateListenAddr(&v, addr)
+	config.validate(&v)
+	return v.err()
+}
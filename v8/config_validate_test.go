@@ -0,0 +1,40 @@
+package norddrop
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateChecksumEventsGranularity(t *testing.T) {
+	value := func(g uint64) *uint64 { return &g }
+
+	tests := []struct {
+		granularity *uint64
+		valid       bool
+	}{
+		{nil, true},
+		{value(1), true},
+		{value(64 * 1024), true},
+		{value(MaxChecksumEventsGranularity), true},
+		{value(0), false},
+		{value(MaxChecksumEventsGranularity + 1), false},
+		{value(^uint64(0)), false},
+	}
+	for _, tt := range tests {
+		config := DefaultConfig()
+		config.ChecksumEventsGranularity = tt.granularity
+
+		var verrs ValidationErrors
+		errors.As(config.Validate(), &verrs)
+		errs := verrs.Field("ChecksumEventsGranularity")
+		if valid := len(errs) == 0; valid != tt.valid {
+			t.Errorf("granularity %v: errors %v", tt.granularity, errs)
+		}
+		for _, err := range errs {
+			var fieldErr *FieldError
+			if !errors.As(err, &fieldErr) {
+				t.Errorf("%v is not a FieldError", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,303 @@
+package norddrop
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Configuration of `Diagnostics`
+type DiagnosticsConfig struct {
+	// Number of log lines kept, 1000 if zero
+	LogLines int
+	// Number of events kept, 1000 if zero
+	Events int
+	// Most verbose level captured into the buffer regardless of the level of
+	// the wrapped logger. Zero captures what the wrapped logger receives.
+	CaptureLevel LogLevel
+	// How far back the support bundle lists transfers, 7 days if zero
+	TransfersWindow time.Duration
+	// Applied to the transfers, events and logs of the support bundle,
+	// e.g. `DefaultRedactor()`. Without it they are written raw, including
+	// file paths and peer addresses.
+	Redactor *Redactor
+}
+
+type ringBuffer[T any] struct {
+	mu    sync.Mutex
+	items []T
+	next  int
+	full  bool
+}
+
+func newRingBuffer[T any](size int) *ringBuffer[T] {
+	return &ringBuffer[T]{items: make([]T, size)}
+}
+
+func (r *ringBuffer[T]) push(item T) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.items[r.next] = item
+	r.next = (r.next + 1) % len(r.items)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// Returns the items oldest first
+func (r *ringBuffer[T]) snapshot() []T {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.full {
+		return append([]T(nil), r.items[:r.next]...)
+	}
+	return append(append([]T(nil), r.items[r.next:]...), r.items[:r.next]...)
+}
+
+type diagnosticsLogLine struct {
+	time  time.Time
+	level LogLevel
+	msg   string
+}
+
+// Logger and EventCallback decorator remembering the most recent log lines
+// and events in memory so they can be exported with `ExportSupportBundle()`
+// when a user reports a problem.
+//
+// The same instance is passed to `NewNordDrop()` as both the event callback
+// and the logger, and attached with `Bind()` afterwards.
+type Diagnostics struct {
+	logger  Logger
+	events  EventCallback
+	config  DiagnosticsConfig
+	started time.Time
+
+	logLines   *ringBuffer[diagnosticsLogLine]
+	eventLog   *ringBuffer[Event]
+	drop       atomic.Pointer[NordDrop]
+	dropConfig atomic.Pointer[Config]
+}
+
+// # Arguments
+// * `logger` - Wrapped logger, may be `nil`
+// * `events` - Wrapped event callback, may be `nil`
+// * `config` - Buffer sizes and capture level
+func NewDiagnostics(logger Logger, events EventCallback, config DiagnosticsConfig) *Diagnostics {
+	if config.LogLines <= 0 {
+		config.LogLines = 1000
+	}
+	if config.Events <= 0 {
+		config.Events = 1000
+	}
+	if config.TransfersWindow <= 0 {
+		config.TransfersWindow = 7 * 24 * time.Hour
+	}
+
+	return &Diagnostics{
+		logger:   logger,
+		events:   events,
+		config:   config,
+		started:  time.Now(),
+		logLines: newRingBuffer[diagnosticsLogLine](config.LogLines),
+		eventLog: newRingBuffer[Event](config.Events),
+	}
+}
+
+// Attaches the instance and the configuration it was started with. Both are
+// included in the support bundle.
+func (d *Diagnostics) Bind(drop *NordDrop, config Config) {
+	d.drop.Store(drop)
+	d.dropConfig.Store(&config)
+}
+
+func (d *Diagnostics) wrapped() []any {
+	return []any{d.logger, d.events}
+}
+
+func (d *Diagnostics) OnLog(level LogLevel, msg string) {
+	if level <= d.captureLevel() {
+		d.logLines.push(diagnosticsLogLine{time: time.Now(), level: level, msg: msg})
+	}
+	if d.logger != nil && level <= d.logger.Level() {
+		d.logger.OnLog(level, msg)
+	}
+}
+
+func (d *Diagnostics) Level() LogLevel {
+	level := d.captureLevel()
+	if d.logger != nil && d.logger.Level() > level {
+		level = d.logger.Level()
+	}
+	return level
+}
+
+func (d *Diagnostics) captureLevel() LogLevel {
+	if d.config.CaptureLevel != 0 {
+		return d.config.CaptureLevel
+	}
+	if d.logger != nil {
+		return d.logger.Level()
+	}
+	return LogLevelInfo
+}
+
+func (d *Diagnostics) OnEvent(event Event) {
+	d.eventLog.push(event)
+	if d.events != nil {
+		d.events.OnEvent(event)
+	}
+}
+
+// Writes a zip archive with the buffered logs and events, the libdrop
+// version, the sanitized configuration, recent transfers and Go runtime
+// statistics. Parts that cannot be collected are replaced by a file
+// describing the error.
+//
+// Only the configuration is always sanitized. The transfers, events and
+// logs contain full file paths and peer addresses unless
+// `DiagnosticsConfig.Redactor` is set.
+func (d *Diagnostics) ExportSupportBundle(w io.Writer) error {
+	zw := zip.NewWriter(w)
+
+	files := []struct {
+		name  string
+		write func(io.Writer) error
+	}{
+		{"version.txt", d.writeVersion},
+		{"runtime.json", d.writeRuntime},
+		{"config.json", d.writeConfig},
+		{"transfers.json", d.writeTransfers},
+		{"events.jsonl", d.writeEvents},
+		{"logs.txt", d.writeLogs},
+	}
+	for _, file := range files {
+		fw, err := zw.Create(file.name)
+		if err != nil {
+			return err
+		}
+		if err := file.write(fw); err != nil {
+			ew, zerr := zw.Create(file.name + ".error.txt")
+			if zerr != nil {
+				return zerr
+			}
+			fmt.Fprintln(ew, err)
+		}
+	}
+	return zw.Close()
+}
+
+func (d *Diagnostics) writeVersion(w io.Writer) error {
+	_, err := fmt.Fprintln(w, Version())
+	return err
+}
+
+func (d *Diagnostics) writeRuntime(w io.Writer) error {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	return writeIndentedJSON(w, map[string]any{
+		"go_version":     runtime.Version(),
+		"os":             runtime.GOOS,
+		"arch":           runtime.GOARCH,
+		"num_cpu":        runtime.NumCPU(),
+		"num_goroutine":  runtime.NumGoroutine(),
+		"uptime_seconds": int64(time.Since(d.started).Seconds()),
+		"heap_alloc":     mem.HeapAlloc,
+		"heap_sys":       mem.HeapSys,
+		"num_gc":         mem.NumGC,
+		"collected_at":   time.Now().UTC(),
+	})
+}
+
+// Paths are reduced to their base names so no user directories leak
+func (d *Diagnostics) writeConfig(w io.Writer) error {
+	config := d.dropConfig.Load()
+	if config == nil {
+		return fmt.Errorf("Diagnostics is not bound to a NordDrop instance")
+	}
+	sanitized := *config
+	sanitized.MooseEventPath = sanitizePath(sanitized.MooseEventPath)
+	sanitized.StoragePath = sanitizePath(sanitized.StoragePath)
+	return writeIndentedJSON(w, sanitized)
+}
+
+func sanitizePath(path string) string {
+	if path == "" {
+		return ""
+	}
+	return filepath.Base(path)
+}
+
+func (d *Diagnostics) writeTransfers(w io.Writer) error {
+	drop := d.drop.Load()
+	if drop == nil {
+		return fmt.Errorf("Diagnostics is not bound to a NordDrop instance")
+	}
+	transfers, err := drop.TransfersSince(time.Now().Add(-d.config.TransfersWindow).UnixMilli())
+	if err != nil {
+		return err
+	}
+	if d.config.Redactor == nil {
+		return writeIndentedJSON(w, transfers)
+	}
+
+	data, err := json.Marshal(transfers)
+	if err != nil {
+		return err
+	}
+	if data, err = d.config.Redactor.JSON(data); err != nil {
+		return err
+	}
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, data, "", "  "); err != nil {
+		return err
+	}
+	indented.WriteByte('\n')
+	_, err = indented.WriteTo(w)
+	return err
+}
+
+func (d *Diagnostics) writeEvents(w io.Writer) error {
+	for _, event := range d.eventLog.snapshot() {
+		data, err := json.Marshal(event)
+		if d.config.Redactor != nil {
+			data, err = d.config.Redactor.Event(event)
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(append(data, '\n')); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *Diagnostics) writeLogs(w io.Writer) error {
+	for _, line := range d.logLines.snapshot() {
+		ts := line.time.UTC().Format(time.RFC3339Nano)
+		msg := line.msg
+		if d.config.Redactor != nil {
+			msg = d.config.Redactor.String(msg)
+		}
+		if _, err := fmt.Fprintf(w, "%s %s %s\n", ts, line.level, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeIndentedJSON(w io.Writer, value any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(value)
+}
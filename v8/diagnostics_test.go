@@ -0,0 +1,38 @@
+package norddrop
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestDiagnosticsRedactor(t *testing.T) {
+	event := Event{Timestamp: 1, Kind: EventKindFileDownloaded{
+		TransferId: "3fa85f64-5717-4562-b3fc-2c963f66afa6",
+		FileId:     "file",
+		FinalPath:  "/home/John Smith/tax return.pdf",
+	}}
+	msg := "Connecting to 192.168.17.42 for /home/John Smith/tax return.pdf"
+
+	for _, redactor := range []*Redactor{nil, DefaultRedactor([]byte("salt"))} {
+		d := NewDiagnostics(nil, nil, DiagnosticsConfig{Redactor: redactor})
+		d.OnEvent(event)
+		d.OnLog(LogLevelInfo, msg)
+
+		var out bytes.Buffer
+		if err := d.writeEvents(&out); err != nil {
+			t.Fatal(err)
+		}
+		if err := d.writeLogs(&out); err != nil {
+			t.Fatal(err)
+		}
+
+		leaked := strings.Contains(out.String(), "John Smith") || strings.Contains(out.String(), "192.168.17.42")
+		if redactor == nil && !leaked {
+			t.Errorf("raw output redacted: %s", out.String())
+		}
+		if redactor != nil && leaked {
+			t.Errorf("redacted output leaks: %s", out.String())
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package norddrop
+
+// Returns the transfer ID the event refers to, `false` for events not bound
+// to a transfer
+func eventTransferId(kind EventKind) (string, bool) {
+	switch k := kind.(type) {
+	case EventKindRequestReceived:
+		return k.TransferId, true
+	case EventKindRequestQueued:
+		return k.TransferId, true
+	case EventKindFileStarted:
+		return k.TransferId, true
+	case EventKindFileProgress:
+		return k.TransferId, true
+	case EventKindFileDownloaded:
+		return k.TransferId, true
+	case EventKindFileUploaded:
+		return k.TransferId, true
+	case EventKindFileFailed:
+		return k.TransferId, true
+	case EventKindFileRejected:
+		return k.TransferId, true
+	case EventKindFilePaused:
+		return k.TransferId, true
+	case EventKindFileThrottled:
+		return k.TransferId, true
+	case EventKindFilePending:
+		return k.TransferId, true
+	case EventKindTransferFinalized:
+		return k.TransferId, true
+	case EventKindTransferFailed:
+		return k.TransferId, true
+	case EventKindTransferDeferred:
+		return k.TransferId, true
+	case EventKindFinalizeChecksumStarted:
+		return k.TransferId, true
+	case EventKindFinalizeChecksumFinished:
+		return k.TransferId, true
+	case EventKindFinalizeChecksumProgress:
+		return k.TransferId, true
+	case EventKindVerifyChecksumStarted:
+		return k.TransferId, true
+	case EventKindVerifyChecksumFinished:
+		return k.TransferId, true
+	case EventKindVerifyChecksumProgress:
+		return k.TransferId, true
+	default:
+		return "", false
+	}
+}
+
+// Adapts an ordinary function to the `EventCallback` interface
+type EventCallbackFunc func(event Event)
+
+func (f EventCallbackFunc) OnEvent(event Event) {
+	f(event)
+}
@@ -0,0 +1,25 @@
+package norddrop
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// Name of the event kind without the `EventKind` prefix, e.g. `FileFailed`
+func eventKindName(kind EventKind) string {
+	if kind == nil {
+		return ""
+	}
+	return strings.TrimPrefix(reflect.TypeOf(kind).Name(), "EventKind")
+}
+
+// Encodes the event as `{"timestamp": .., "kind": "FileFailed", "data":
+// {..}}` since the variant name of `Kind` is lost by the default encoding
+func (e Event) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Timestamp int64     `json:"timestamp"`
+		Kind      string    `json:"kind"`
+		Data      EventKind `json:"data"`
+	}{e.Timestamp, eventKindName(e.Kind), e.Kind})
+}
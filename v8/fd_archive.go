@@ -0,0 +1,79 @@
+//go:build unix
+
+package norddrop
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Queues the directory as a single tar archive, compressed with `codec`
+// unless it is `nil`. Sending one archive avoids the per-file overhead of
+// trees with many small files as well as `TransferFileLimit` and
+// `DirDepthLimit`. The receiver unpacks it with `UnpackArchive()` or
+// `ArchiveUnpacker`.
+//
+// `ArchiveGzip` and `ArchiveZstd` are built in, see `ArchiveCodec`.
+//
+// The archive is produced on the first `OnFd()` call into an unlinked
+// temporary file in `os.TempDir()` and served from there, so the directory
+// needs as much free disk space there as the archive takes. It cannot be
+// streamed through a pipe: libdrop needs the file size before sending and
+// reads the file again for checksums and resumed transfers.
+func (r *FdRegistry) AddDirectory(dir string, codec *ArchiveCodec) TransferDescriptorFd {
+	filename := filepath.Base(filepath.Clean(dir)) + ".tar"
+	if codec != nil {
+		filename += codec.Extension
+	}
+
+	var (
+		once    sync.Once
+		err     error
+		reopen  FdOpener
+		release = func() {}
+	)
+	build := func() {
+		backing, berr := newSpoolFile(filename)
+		if err = berr; err != nil {
+			return
+		}
+		if err = WriteArchive(backing, dir, codec); err != nil {
+			backing.Close()
+			return
+		}
+		reopen = func() (*os.File, error) {
+			return reopenMemoryFile(backing)
+		}
+		release = func() {
+			backing.Close()
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nextMem++
+	uri := fmt.Sprintf("archive://%d/%s", r.nextMem, url.PathEscape(filename))
+	r.register(&fdEntry{
+		uri:      uri,
+		filename: filename,
+		opener: func() (*os.File, error) {
+			once.Do(build)
+			if reopen == nil {
+				return nil, err
+			}
+			return reopen()
+		},
+		release: func() {
+			// Keeps a concurrent first open from building after release
+			once.Do(func() {
+				err = fmt.Errorf("archive of %s was released", dir)
+			})
+			release()
+		},
+	})
+	return TransferDescriptorFd{Filename: filename, ContentUri: uri}
+}
@@ -0,0 +1,29 @@
+//go:build unix
+
+package norddrop
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestAddDirectoryReleasedBeforeOpen(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "tree")
+	writeTestFile(t, filepath.Join(dir, "a.txt"), "a")
+
+	r := NewFdRegistry(nil)
+	var failed error
+	r.OnError(func(uri string, err error) { failed = err })
+
+	desc := r.AddDirectory(dir, nil)
+	entry := r.entries[desc.ContentUri]
+	r.Unregister(desc.ContentUri)
+
+	// OnFd() looked the entry up before it was unregistered
+	if file, err := entry.opener(); err == nil || file != nil {
+		t.Errorf("opener() = %v, %v after release", file, err)
+	}
+	if fd := r.OnFd(desc.ContentUri); fd != nil || failed == nil {
+		t.Errorf("OnFd() = %v, error %v after release", fd, failed)
+	}
+}
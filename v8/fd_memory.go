@@ -0,0 +1,69 @@
+//go:build unix
+
+package norddrop
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+)
+
+// Queues the data as a file named `filename`. The data is copied into an
+// anonymous in-memory file, see `AddReader()`.
+func (r *FdRegistry) AddBytes(filename string, data []byte) (TransferDescriptorFd, error) {
+	return r.AddReader(filename, bytes.NewReader(data))
+}
+
+// Queues the reader's content as a file named `filename`, registered under a
+// `mem://` content URI.
+//
+// libdrop learns the file size with `fstat()` and reads the file more than
+// once: for checksums, when a transfer is resumed and when the peer
+// requests it again. A pipe supports neither, so the reader is drained up
+// front into a memfd (an unlinked temporary file on systems without one) and
+// every `OnFd()` call opens the content anew from the start. The memory is
+// released when the transfer is finalized or the URI unregistered.
+func (r *FdRegistry) AddReader(filename string, rd io.Reader) (TransferDescriptorFd, error) {
+	backing, err := newMemoryFile(filename)
+	if err != nil {
+		return TransferDescriptorFd{}, err
+	}
+	if _, err := io.Copy(backing, rd); err != nil {
+		backing.Close()
+		return TransferDescriptorFd{}, fmt.Errorf("buffering %s: %w", filename, err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nextMem++
+	uri := fmt.Sprintf("mem://%d/%s", r.nextMem, url.PathEscape(filename))
+	r.register(&fdEntry{
+		uri:      uri,
+		filename: filename,
+		opener: func() (*os.File, error) {
+			return reopenMemoryFile(backing)
+		},
+		release: func() {
+			backing.Close()
+		},
+	})
+	return TransferDescriptorFd{Filename: filename, ContentUri: uri}, nil
+}
+
+// Copies the reader into an anonymous in-memory file and returns it opened
+// for reading from the start
+func bufferToFile(name string, rd io.Reader) (*os.File, error) {
+	backing, err := newMemoryFile(name)
+	if err != nil {
+		return nil, err
+	}
+	defer backing.Close()
+
+	if _, err := io.Copy(backing, rd); err != nil {
+		return nil, fmt.Errorf("buffering %s: %w", name, err)
+	}
+	return reopenMemoryFile(backing)
+}
@@ -0,0 +1,38 @@
+package norddrop
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+func newMemoryFile(name string) (*os.File, error) {
+	fd, err := unix.MemfdCreate("norddrop:"+name, unix.MFD_CLOEXEC)
+	if err != nil {
+		return nil, fmt.Errorf("creating memfd: %w", err)
+	}
+	return os.NewFile(uintptr(fd), name), nil
+}
+
+// Creates an unlinked file on disk in `os.TempDir()` for content too big
+// for memory. It is reopened the same way as memory files.
+func newSpoolFile(name string) (*os.File, error) {
+	fd, err := unix.Open(os.TempDir(), unix.O_TMPFILE|unix.O_RDWR|unix.O_CLOEXEC, 0o600)
+	if err == nil {
+		return os.NewFile(uintptr(fd), name), nil
+	}
+	// Not every file system supports O_TMPFILE
+	f, err := os.CreateTemp("", "norddrop-*")
+	if err != nil {
+		return nil, err
+	}
+	os.Remove(f.Name())
+	return f, nil
+}
+
+// Opening the memfd or spool file through procfs creates a new open file
+// description, so every reader gets its own offset
+func reopenMemoryFile(f *os.File) (*os.File, error) {
+	return os.Open(fmt.Sprintf("/proc/self/fd/%d", f.Fd()))
+}
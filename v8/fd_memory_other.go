@@ -0,0 +1,36 @@
+//go:build unix && !linux
+
+package norddrop
+
+import (
+	"os"
+)
+
+type memoryFile struct {
+	*os.File
+}
+
+// Without memfd the content lives in a temporary file which is only unlinked
+// on release, so it can be opened by path again
+func newMemoryFile(name string) (*memoryFile, error) {
+	f, err := os.CreateTemp("", "norddrop-*")
+	if err != nil {
+		return nil, err
+	}
+	return &memoryFile{f}, nil
+}
+
+// The temporary file is on disk already
+func newSpoolFile(name string) (*memoryFile, error) {
+	return newMemoryFile(name)
+}
+
+func (f *memoryFile) Close() error {
+	err := f.File.Close()
+	os.Remove(f.Name())
+	return err
+}
+
+func reopenMemoryFile(f *memoryFile) (*os.File, error) {
+	return os.Open(f.Name())
+}
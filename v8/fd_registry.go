@@ -0,0 +1,359 @@
+//go:build unix
+
+package norddrop
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// Opens the file served for a content URI. Called lazily, every time
+// libdrop asks for a descriptor.
+type FdOpener func() (*os.File, error)
+
+// A descriptor opened by `FdRegistry`
+type FdInfo struct {
+	ContentUri string
+	Filename   string
+	// Transfer and file the descriptor serves, empty until the transfer is
+	// queued
+	TransferId string
+	FileId     string
+	Fd         int
+	Opened     time.Time
+}
+
+type fdEntry struct {
+	uri        string
+	filename   string
+	opener     FdOpener
+	release    func()
+	transferId string
+	fileId     string
+	files      []*fdOpenFile
+}
+
+type fdOpenFile struct {
+	file   *os.File
+	opened time.Time
+}
+
+type fdFileKey struct {
+	transferId string
+	fileId     string
+}
+
+// FdResolver opening registered content URIs on demand and closing them when
+// the file reaches a terminal state. It also has to receive libdrop events,
+// so it wraps the application's EventCallback.
+//
+// libdrop takes ownership of the descriptor returned from `OnFd()`, so the
+// registry hands out a duplicate and keeps the original `*os.File`. The
+// originals are closed on `EventKindFileUploaded`, `EventKindFileFailed`,
+// `EventKindFileRejected` and `EventKindTransferFinalized`.
+type FdRegistry struct {
+	next EventCallback
+
+	mu       sync.Mutex
+	entries  map[string]*fdEntry
+	byFile   map[fdFileKey]*fdEntry
+	onError  func(uri string, err error)
+	fallback URIHandler
+	nextMem  uint64
+}
+
+// # Arguments
+// * `next` - Callback receiving all events, may be `nil`
+func NewFdRegistry(next EventCallback) *FdRegistry {
+	return &FdRegistry{
+		next:    next,
+		entries: map[string]*fdEntry{},
+		byFile:  map[fdFileKey]*fdEntry{},
+	}
+}
+
+// Sets the function notified when opening a URI fails. `OnFd()` can only
+// report failures to libdrop as a missing descriptor.
+func (r *FdRegistry) OnError(fn func(uri string, err error)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onError = fn
+}
+
+// Makes `OnFd()` open URIs that were not registered with the handler, e.g.
+// a `SchemeResolver`. Such URIs are registered on first use under the last
+// element of their path as filename.
+func (r *FdRegistry) SetFallback(handler URIHandler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.fallback = handler
+}
+
+// Registers the opener for the content URI and returns the descriptor to
+// pass to `NewTransfer()`. Files are matched with the queued transfer by
+// `filename`.
+func (r *FdRegistry) Register(uri string, filename string, opener FdOpener) TransferDescriptorFd {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.register(&fdEntry{uri: uri, filename: filename, opener: opener})
+	return TransferDescriptorFd{Filename: filename, ContentUri: uri}
+}
+
+// Needs `r.mu` held
+func (r *FdRegistry) register(entry *fdEntry) {
+	if old, ok := r.entries[entry.uri]; ok {
+		r.closeEntry(old)
+		r.removeEntry(old)
+	}
+	r.entries[entry.uri] = entry
+}
+
+// Registers a file on disk under the content URI
+func (r *FdRegistry) RegisterPath(uri string, path string) TransferDescriptorFd {
+	return r.Register(uri, baseName(path), func() (*os.File, error) {
+		return os.Open(path)
+	})
+}
+
+// Closes the URI's descriptors and forgets it
+func (r *FdRegistry) Unregister(uri string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if entry, ok := r.entries[uri]; ok {
+		r.closeEntry(entry)
+		r.removeEntry(entry)
+	}
+}
+
+func (r *FdRegistry) OnFd(contentUri string) *int32 {
+	r.mu.Lock()
+	entry, ok := r.entries[contentUri]
+	if !ok && r.fallback != nil {
+		fallback := r.fallback
+		entry = &fdEntry{
+			uri:      contentUri,
+			filename: uriFilename(contentUri),
+			opener: func() (*os.File, error) {
+				return fallback.Open(contentUri)
+			},
+		}
+		r.register(entry)
+		ok = true
+	}
+	onError := r.onError
+	r.mu.Unlock()
+
+	if !ok {
+		r.reportError(onError, contentUri, fmt.Errorf("content URI is not registered"))
+		return nil
+	}
+
+	file, err := entry.opener()
+	if err != nil {
+		r.reportError(onError, contentUri, err)
+		return nil
+	}
+	fd, err := unix.FcntlInt(file.Fd(), unix.F_DUPFD_CLOEXEC, 0)
+	if err != nil {
+		file.Close()
+		r.reportError(onError, contentUri, fmt.Errorf("duplicating descriptor: %w", err))
+		return nil
+	}
+
+	r.mu.Lock()
+	// The entry may have been unregistered, replaced or finalized while
+	// opening, its files would never be closed then
+	if r.entries[contentUri] != entry {
+		r.mu.Unlock()
+		unix.Close(fd)
+		file.Close()
+		r.reportError(onError, contentUri, fmt.Errorf("content URI was unregistered while opening"))
+		return nil
+	}
+	entry.files = append(entry.files, &fdOpenFile{file: file, opened: time.Now()})
+	r.mu.Unlock()
+
+	result := int32(fd)
+	return &result
+}
+
+func (r *FdRegistry) reportError(onError func(string, error), uri string, err error) {
+	if onError != nil {
+		onError(uri, err)
+	}
+}
+
+func (r *FdRegistry) wrapped() []any {
+	return []any{r.next}
+}
+
+func (r *FdRegistry) OnEvent(event Event) {
+	switch k := event.Kind.(type) {
+	case EventKindRequestQueued:
+		r.bind(k.TransferId, k.Files)
+	case EventKindFileUploaded:
+		r.fileDone(k.TransferId, k.FileId)
+	case EventKindFileFailed:
+		r.fileDone(k.TransferId, k.FileId)
+	case EventKindFileRejected:
+		r.fileDone(k.TransferId, k.FileId)
+	case EventKindTransferFinalized:
+		r.transferDone(k.TransferId)
+	}
+
+	if r.next != nil {
+		r.next.OnEvent(event)
+	}
+}
+
+// Matches queued files with registered URIs by filename, the first unbound
+// entry wins
+func (r *FdRegistry) bind(transferId string, files []QueuedFile) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	uris := make([]string, 0, len(r.entries))
+	for uri := range r.entries {
+		uris = append(uris, uri)
+	}
+	sort.Strings(uris)
+
+	for _, file := range files {
+		for _, uri := range uris {
+			entry := r.entries[uri]
+			if entry.transferId == "" && entry.filename == file.Path {
+				entry.transferId = transferId
+				entry.fileId = file.Id
+				r.byFile[fdFileKey{transferId, file.Id}] = entry
+				break
+			}
+		}
+	}
+}
+
+func (r *FdRegistry) fileDone(transferId string, fileId string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if entry, ok := r.byFile[fdFileKey{transferId, fileId}]; ok {
+		r.closeEntry(entry)
+	}
+}
+
+func (r *FdRegistry) transferDone(transferId string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for key, entry := range r.byFile {
+		if key.transferId == transferId {
+			r.closeEntry(entry)
+			r.removeEntry(entry)
+		}
+	}
+}
+
+// Needs `r.mu` held
+func (r *FdRegistry) closeEntry(entry *fdEntry) {
+	for _, f := range entry.files {
+		f.file.Close()
+	}
+	entry.files = nil
+}
+
+// Needs `r.mu` held
+func (r *FdRegistry) removeEntry(entry *fdEntry) {
+	if r.entries[entry.uri] == entry {
+		delete(r.entries, entry.uri)
+	}
+	if entry.transferId != "" {
+		delete(r.byFile, fdFileKey{entry.transferId, entry.fileId})
+	}
+	if entry.release != nil {
+		entry.release()
+		entry.release = nil
+	}
+}
+
+// Lists the descriptors currently held open
+func (r *FdRegistry) OpenDescriptors() []FdInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.collect(func(*fdEntry, *fdOpenFile) bool { return true })
+}
+
+// Lists descriptors that look leaked: open for longer than `olderThan` while
+// not bound to any queued transfer file. Descriptors of bound files are
+// closed by the registry itself once the file reaches a terminal state.
+func (r *FdRegistry) Leaks(olderThan time.Duration) []FdInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	return r.collect(func(entry *fdEntry, f *fdOpenFile) bool {
+		return entry.transferId == "" && now.Sub(f.opened) > olderThan
+	})
+}
+
+// Needs `r.mu` held
+func (r *FdRegistry) collect(filter func(*fdEntry, *fdOpenFile) bool) []FdInfo {
+	var infos []FdInfo
+	for _, entry := range r.entries {
+		for _, f := range entry.files {
+			if !filter(entry, f) {
+				continue
+			}
+			infos = append(infos, FdInfo{
+				ContentUri: entry.uri,
+				Filename:   entry.filename,
+				TransferId: entry.transferId,
+				FileId:     entry.fileId,
+				Fd:         int(f.file.Fd()),
+				Opened:     f.opened,
+			})
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Opened.Before(infos[j].Opened) })
+	return infos
+}
+
+// Closes every descriptor and forgets all URIs. Returns the descriptors
+// that were still open, which at shutdown means they were leaked.
+func (r *FdRegistry) Close() []FdInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	open := r.collect(func(*fdEntry, *fdOpenFile) bool { return true })
+	for _, entry := range r.entries {
+		r.closeEntry(entry)
+		r.removeEntry(entry)
+	}
+	r.entries = map[string]*fdEntry{}
+	r.byFile = map[fdFileKey]*fdEntry{}
+	return open
+}
+
+func baseName(path string) string {
+	for i := len(path) - 1; i >= 0; i-- {
+		if os.IsPathSeparator(path[i]) {
+			return path[i+1:]
+		}
+	}
+	return path
+}
+
+func uriFilename(uri string) string {
+	name := path.Base(strings.TrimRight(uri, "/"))
+	if unescaped, err := url.PathUnescape(name); err == nil {
+		return unescaped
+	}
+	return name
+}
@@ -0,0 +1,34 @@
+//go:build unix
+
+package norddrop
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOnFdUnregisteredWhileOpening(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.txt")
+	writeTestFile(t, path, "a")
+
+	r := NewFdRegistry(nil)
+	var opened *os.File
+	desc := r.Register("test://a.txt", "a.txt", func() (*os.File, error) {
+		// Runs without the registry lock, like a concurrent `Unregister()`
+		r.Unregister("test://a.txt")
+		f, err := os.Open(path)
+		opened = f
+		return f, err
+	})
+
+	if fd := r.OnFd(desc.ContentUri); fd != nil {
+		t.Errorf("OnFd() = %d for an unregistered URI", *fd)
+	}
+	if open := r.OpenDescriptors(); len(open) != 0 {
+		t.Errorf("descriptors held: %v", open)
+	}
+	if err := opened.Close(); err == nil {
+		t.Error("opened file left open")
+	}
+}
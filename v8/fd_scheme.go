@@ -0,0 +1,255 @@
+//go:build unix
+
+package norddrop
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+// Err* are used for checking error type with `errors.Is`
+var ErrUnknownScheme = fmt.Errorf("UnknownScheme")
+var ErrInvalidURI = fmt.Errorf("InvalidURI")
+
+// Opens the file a content URI points at
+type URIHandler interface {
+	Open(uri string) (*os.File, error)
+}
+
+// Adapts an ordinary function to the `URIHandler` interface
+type URIHandlerFunc func(uri string) (*os.File, error)
+
+func (f URIHandlerFunc) Open(uri string) (*os.File, error) {
+	return f(uri)
+}
+
+// FdResolver dispatching content URIs to handlers by scheme. `file://` is
+// handled out of the box, other schemes are added with `Handle()`.
+//
+// It can be passed to `SetFdResolver()` directly, or used by `FdRegistry`
+// for URIs that were not registered, see `FdRegistry.SetFallback()`.
+type SchemeResolver struct {
+	mu       sync.RWMutex
+	handlers map[string]URIHandler
+	onError  func(uri string, err error)
+}
+
+func NewSchemeResolver() *SchemeResolver {
+	return &SchemeResolver{
+		handlers: map[string]URIHandler{"file": FileURIHandler("")},
+	}
+}
+
+// Registers the handler for the scheme, replacing any previous one. Schemes
+// are case insensitive.
+func (s *SchemeResolver) Handle(scheme string, handler URIHandler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[strings.ToLower(scheme)] = handler
+}
+
+// Sets the function notified when resolving a URI fails. `OnFd()` can only
+// report failures to libdrop as a missing descriptor.
+func (s *SchemeResolver) OnError(fn func(uri string, err error)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onError = fn
+}
+
+// Opens the URI with the handler of its scheme
+func (s *SchemeResolver) Open(uri string) (*os.File, error) {
+	scheme, _, ok := strings.Cut(uri, "://")
+	if !ok || scheme == "" {
+		return nil, fmt.Errorf("%w: %q has no scheme", ErrInvalidURI, uri)
+	}
+	scheme = strings.ToLower(scheme)
+
+	s.mu.RLock()
+	handler, ok := s.handlers[scheme]
+	var known []string
+	if !ok {
+		for name := range s.handlers {
+			known = append(known, name)
+		}
+	}
+	s.mu.RUnlock()
+
+	if !ok {
+		sort.Strings(known)
+		return nil, fmt.Errorf("%w %q in %q, handled schemes: %s",
+			ErrUnknownScheme, scheme, uri, strings.Join(known, ", "))
+	}
+	return handler.Open(uri)
+}
+
+// libdrop takes ownership of the returned descriptor
+func (s *SchemeResolver) OnFd(contentUri string) *int32 {
+	file, err := s.Open(contentUri)
+	if err == nil {
+		defer file.Close()
+		var fd int
+		fd, err = unix.FcntlInt(file.Fd(), unix.F_DUPFD_CLOEXEC, 0)
+		if err == nil {
+			result := int32(fd)
+			return &result
+		}
+	}
+
+	s.mu.RLock()
+	onError := s.onError
+	s.mu.RUnlock()
+	if onError != nil {
+		onError(contentUri, err)
+	}
+	return nil
+}
+
+// Returns the unescaped part of the URI following `scheme://`
+func uriPath(uri string) (string, error) {
+	_, rest, ok := strings.Cut(uri, "://")
+	if !ok {
+		return "", fmt.Errorf("%w: %q has no scheme", ErrInvalidURI, uri)
+	}
+	unescaped, err := url.PathUnescape(rest)
+	if err != nil {
+		return "", fmt.Errorf("%w: %q: %v", ErrInvalidURI, uri, err)
+	}
+	return unescaped, nil
+}
+
+// Resolves `name` inside `root`, refusing names escaping it. An empty root
+// only accepts absolute names.
+func resolveUnder(root string, name string) (string, error) {
+	if root == "" {
+		if !filepath.IsAbs(name) {
+			return "", fmt.Errorf("%w: %q is not an absolute path", ErrInvalidURI, name)
+		}
+		return filepath.Clean(name), nil
+	}
+	resolved := filepath.Join(root, filepath.FromSlash(path.Clean("/"+name)))
+	if rel, err := filepath.Rel(root, resolved); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%w: %q escapes %s", ErrInvalidURI, name, root)
+	}
+	return resolved, nil
+}
+
+// Handles `file:///path/to/file`. With a non-empty `root` paths are
+// relative to it and may not leave it.
+func FileURIHandler(root string) URIHandler {
+	return URIHandlerFunc(func(uri string) (*os.File, error) {
+		name, err := uriPath(uri)
+		if err != nil {
+			return nil, err
+		}
+		resolved, err := resolveUnder(root, name)
+		if err != nil {
+			return nil, err
+		}
+		return os.Open(resolved)
+	})
+}
+
+// Handles `zip://archive.zip!/member/path`, serving the decompressed member
+// from memory. The archive path is resolved as in `FileURIHandler()`.
+func ZipURIHandler(root string) URIHandler {
+	return URIHandlerFunc(func(uri string) (*os.File, error) {
+		name, err := uriPath(uri)
+		if err != nil {
+			return nil, err
+		}
+		archive, member, ok := strings.Cut(name, "!/")
+		if !ok || member == "" {
+			return nil, fmt.Errorf("%w: %q does not name an archive member as archive!/member", ErrInvalidURI, uri)
+		}
+		resolved, err := resolveUnder(root, archive)
+		if err != nil {
+			return nil, err
+		}
+
+		zr, err := zip.OpenReader(resolved)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+
+		member = path.Clean(member)
+		for _, f := range zr.File {
+			if path.Clean(f.Name) != member || f.FileInfo().IsDir() {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return nil, fmt.Errorf("opening %s in %s: %w", member, archive, err)
+			}
+			defer rc.Close()
+			return bufferToFile(path.Base(member), rc)
+		}
+		return nil, fmt.Errorf("%s has no member %s: %w", archive, member, os.ErrNotExist)
+	})
+}
+
+// Handles URIs ending with the hex SHA-256 of the content, e.g.
+// `app://blob/<id>`, served from a content addressed store where blobs live
+// at `dir/<id[:2]>/<id>`. See `PutBlob()`.
+func BlobStoreURIHandler(dir string) URIHandler {
+	return URIHandlerFunc(func(uri string) (*os.File, error) {
+		name, err := uriPath(uri)
+		if err != nil {
+			return nil, err
+		}
+		blob, err := blobPath(dir, path.Base(name))
+		if err != nil {
+			return nil, err
+		}
+		return os.Open(blob)
+	})
+}
+
+func blobPath(dir string, id string) (string, error) {
+	if _, err := hex.DecodeString(id); err != nil || len(id) != 2*sha256.Size {
+		return "", fmt.Errorf("%w: %q is not a SHA-256 blob ID", ErrInvalidURI, id)
+	}
+	id = strings.ToLower(id)
+	return filepath.Join(dir, id[:2], id), nil
+}
+
+// Stores the reader's content in the blob store directory and returns its
+// ID. Storing the same content twice is a no-op.
+func PutBlob(dir string, rd io.Reader) (string, error) {
+	tmp, err := os.CreateTemp(dir, ".blob-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, hash), rd); err != nil {
+		return "", err
+	}
+	if err := tmp.Sync(); err != nil {
+		return "", err
+	}
+
+	id := hex.EncodeToString(hash.Sum(nil))
+	blob, _ := blobPath(dir, id)
+	if err := os.MkdirAll(filepath.Dir(blob), 0o755); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), blob); err != nil {
+		return "", err
+	}
+	return id, nil
+}
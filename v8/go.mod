@@ -1,3 +1,11 @@
 module github.com/NordSecurity/libdrop-go/v8
 
 go 1.21.1
+
+require (
+	github.com/BurntSushi/toml v1.3.2
+	github.com/klauspost/compress v1.17.11
+	golang.org/x/crypto v0.21.0
+	golang.org/x/sys v0.18.0
+	gopkg.in/yaml.v3 v3.0.1
+)
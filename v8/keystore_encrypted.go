@@ -0,0 +1,280 @@
+package norddrop
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// Encrypted private key file layout (version 1), all integers big endian:
+//
+//	magic      [6]byte  "NDPKEY"
+//	version    uint8    1
+//	kdf        uint8    1 (argon2id)
+//	time       uint32   argon2 passes
+//	memory     uint32   argon2 memory in KiB
+//	threads    uint8    argon2 parallelism
+//	salt       [16]byte
+//	nonce      [24]byte XChaCha20-Poly1305 nonce
+//	ciphertext [48]byte sealed 32 byte key with the header as additional data
+const (
+	keyFileMagic       = "NDPKEY"
+	keyFileVersion1    = 1
+	keyFileKdfArgon2id = 1
+	keyFileSaltSize    = 16
+	keyFileKeySize     = 32
+	keyFileHeaderSize  = len(keyFileMagic) + 2 + 4 + 4 + 1 + keyFileSaltSize + chacha20poly1305.NonceSizeX
+	// Upper limits keeping a corrupt key file from exhausting memory or CPU
+	keyFileMaxTime      = 64
+	keyFileMaxMemoryKiB = 4 * 1024 * 1024
+)
+
+// Err* are used for checking error type with `errors.Is`
+var ErrKeyFileFormat = fmt.Errorf("KeyFileFormat")
+var ErrKeyFileVersion = fmt.Errorf("KeyFileVersion")
+var ErrKeyFilePassphrase = fmt.Errorf("KeyFilePassphrase")
+
+// Key derivation parameters of the encrypted private key file
+type KeyFileParams struct {
+	// Number of argon2id passes, at most 64
+	Time uint32
+	// Memory used by argon2id in KiB, at most 4 GiB
+	MemoryKiB uint32
+	// Argon2id parallelism
+	Threads uint8
+}
+
+func (p KeyFileParams) valid() bool {
+	return p.Time > 0 && p.Time <= keyFileMaxTime &&
+		p.MemoryKiB > 0 && p.MemoryKiB <= keyFileMaxMemoryKiB &&
+		p.Threads > 0
+}
+
+// Parameters used for newly sealed key files
+var DefaultKeyFileParams = KeyFileParams{
+	Time:      3,
+	MemoryKiB: 64 * 1024,
+	Threads:   4,
+}
+
+// Provides the passphrase of the encrypted private key file. The returned
+// slice is owned by the caller and is zeroed once the key is decrypted.
+type PassphraseProvider func() ([]byte, error)
+
+// Encrypts the 32 byte private key with the passphrase and returns the
+// contents of the key file
+func SealPrivkey(privkey []byte, passphrase []byte, params KeyFileParams) ([]byte, error) {
+	if len(privkey) != keyFileKeySize {
+		return nil, fmt.Errorf("private key must be %d bytes, got %d", keyFileKeySize, len(privkey))
+	}
+	if !params.valid() {
+		return nil, fmt.Errorf("invalid key derivation parameters: %+v", params)
+	}
+
+	header := make([]byte, 0, keyFileHeaderSize)
+	header = append(header, keyFileMagic...)
+	header = append(header, keyFileVersion1, keyFileKdfArgon2id)
+	header = binary.BigEndian.AppendUint32(header, params.Time)
+	header = binary.BigEndian.AppendUint32(header, params.MemoryKiB)
+	header = append(header, params.Threads)
+
+	random := make([]byte, keyFileSaltSize+chacha20poly1305.NonceSizeX)
+	if _, err := io.ReadFull(rand.Reader, random); err != nil {
+		return nil, fmt.Errorf("reading random salt: %w", err)
+	}
+	header = append(header, random...)
+	salt := random[:keyFileSaltSize]
+	nonce := random[keyFileSaltSize:]
+
+	key := argon2.IDKey(passphrase, salt, params.Time, params.MemoryKiB, params.Threads, chacha20poly1305.KeySize)
+	defer zeroBytes(key)
+
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Seal(header, nonce, privkey, header), nil
+}
+
+// Decrypts the key file contents produced by `SealPrivkey()`. The caller
+// should zero the returned key once it is no longer needed.
+func OpenPrivkey(data []byte, passphrase []byte) ([]byte, error) {
+	params, err := parseKeyFileHeader(data)
+	if err != nil {
+		return nil, err
+	}
+
+	header := data[:keyFileHeaderSize]
+	salt := header[keyFileHeaderSize-keyFileSaltSize-chacha20poly1305.NonceSizeX : keyFileHeaderSize-chacha20poly1305.NonceSizeX]
+	nonce := header[keyFileHeaderSize-chacha20poly1305.NonceSizeX:]
+
+	key := argon2.IDKey(passphrase, salt, params.Time, params.MemoryKiB, params.Threads, chacha20poly1305.KeySize)
+	defer zeroBytes(key)
+
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, err
+	}
+	privkey, err := aead.Open(nil, nonce, data[keyFileHeaderSize:], header)
+	if err != nil {
+		return nil, ErrKeyFilePassphrase
+	}
+	if len(privkey) != keyFileKeySize {
+		zeroBytes(privkey)
+		return nil, fmt.Errorf("%w: unexpected key size %d", ErrKeyFileFormat, len(privkey))
+	}
+	return privkey, nil
+}
+
+// Returns the format version and key derivation parameters of the key file
+// contents without decrypting it
+func InspectKeyFile(data []byte) (uint8, KeyFileParams, error) {
+	params, err := parseKeyFileHeader(data)
+	if err != nil {
+		return 0, KeyFileParams{}, err
+	}
+	return data[len(keyFileMagic)], params, nil
+}
+
+func parseKeyFileHeader(data []byte) (KeyFileParams, error) {
+	if len(data) < len(keyFileMagic)+1 || string(data[:len(keyFileMagic)]) != keyFileMagic {
+		return KeyFileParams{}, ErrKeyFileFormat
+	}
+	if version := data[len(keyFileMagic)]; version != keyFileVersion1 {
+		return KeyFileParams{}, fmt.Errorf("%w: unsupported version %d", ErrKeyFileVersion, version)
+	}
+	if len(data) < keyFileHeaderSize+chacha20poly1305.Overhead {
+		return KeyFileParams{}, fmt.Errorf("%w: file is truncated", ErrKeyFileFormat)
+	}
+
+	rest := data[len(keyFileMagic)+1:]
+	if rest[0] != keyFileKdfArgon2id {
+		return KeyFileParams{}, fmt.Errorf("%w: unsupported key derivation function %d", ErrKeyFileFormat, rest[0])
+	}
+	params := KeyFileParams{
+		Time:      binary.BigEndian.Uint32(rest[1:5]),
+		MemoryKiB: binary.BigEndian.Uint32(rest[5:9]),
+		Threads:   rest[9],
+	}
+	if !params.valid() {
+		return KeyFileParams{}, fmt.Errorf("%w: invalid key derivation parameters %+v", ErrKeyFileFormat, params)
+	}
+	return params, nil
+}
+
+// Seals the private key and writes it to the given path with `0600`
+// permissions. The file is replaced atomically.
+func WriteEncryptedKeyFile(path string, privkey []byte, passphrase []byte, params KeyFileParams) error {
+	data, err := SealPrivkey(privkey, passphrase, params)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data, 0o600)
+}
+
+// Re-encrypts the key file with a new passphrase and parameters. The file is
+// always written in the current format version, so this is also the way to
+// upgrade older key files.
+func RekeyEncryptedKeyFile(path string, oldPassphrase []byte, newPassphrase []byte, params KeyFileParams) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	privkey, err := OpenPrivkey(data, oldPassphrase)
+	if err != nil {
+		return err
+	}
+	defer zeroBytes(privkey)
+
+	return WriteEncryptedKeyFile(path, privkey, newPassphrase, params)
+}
+
+// KeyStore holding a private key decrypted from a passphrase protected key
+// file. Peer public keys are provided by the `onPubkey` function.
+type EncryptedKeyStore struct {
+	privkey  []byte
+	onPubkey func(peer string) *[]byte
+}
+
+// Reads and decrypts the key file once. The passphrase is requested from the
+// provider and zeroed right after the key is derived.
+//
+// # Arguments
+// * `path` - Path to the file written by `WriteEncryptedKeyFile()`
+// * `passphrase` - Passphrase provider
+// * `onPubkey` - Peer public key lookup, see `KeyStore.OnPubkey()`
+func NewEncryptedKeyStore(path string, passphrase PassphraseProvider, onPubkey func(peer string) *[]byte) (*EncryptedKeyStore, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pass, err := passphrase()
+	if err != nil {
+		return nil, fmt.Errorf("requesting passphrase: %w", err)
+	}
+	privkey, err := OpenPrivkey(data, pass)
+	zeroBytes(pass)
+	if err != nil {
+		return nil, fmt.Errorf("opening %s: %w", path, err)
+	}
+
+	return &EncryptedKeyStore{
+		privkey:  privkey,
+		onPubkey: onPubkey,
+	}, nil
+}
+
+func (ks *EncryptedKeyStore) OnPubkey(peer string) *[]byte {
+	if ks.onPubkey == nil {
+		return nil
+	}
+	return ks.onPubkey(peer)
+}
+
+// Returns the decrypted key itself rather than a copy so that no extra
+// plaintext copies are left behind for the garbage collector.
+func (ks *EncryptedKeyStore) Privkey() []byte {
+	return ks.privkey
+}
+
+// Zeroes the decrypted private key. The store must not be used afterwards.
+func (ks *EncryptedKeyStore) Close() {
+	zeroBytes(ks.privkey)
+}
+
+func zeroBytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
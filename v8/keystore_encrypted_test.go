@@ -0,0 +1,42 @@
+package norddrop
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+func TestKeyFileParamsLimits(t *testing.T) {
+	privkey := bytes.Repeat([]byte{7}, keyFileKeySize)
+	passphrase := []byte("passphrase")
+	data, err := SealPrivkey(privkey, passphrase, KeyFileParams{Time: 1, MemoryKiB: 8, Threads: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := OpenPrivkey(data, passphrase); err != nil || !bytes.Equal(got, privkey) {
+		t.Fatalf("OpenPrivkey() = %x, %v", got, err)
+	}
+
+	// Offsets of the parameters following magic, version and kdf
+	timeAt := len(keyFileMagic) + 2
+	memoryAt := timeAt + 4
+	tests := map[string]func(header []byte){
+		"time":   func(h []byte) { binary.BigEndian.PutUint32(h[timeAt:], keyFileMaxTime+1) },
+		"memory": func(h []byte) { binary.BigEndian.PutUint32(h[memoryAt:], 0xffffffff) },
+	}
+	for name, tamper := range tests {
+		corrupt := bytes.Clone(data)
+		tamper(corrupt)
+		if _, err := OpenPrivkey(corrupt, passphrase); !errors.Is(err, ErrKeyFileFormat) {
+			t.Errorf("%s: OpenPrivkey() = %v, want ErrKeyFileFormat", name, err)
+		}
+		if _, _, err := InspectKeyFile(corrupt); !errors.Is(err, ErrKeyFileFormat) {
+			t.Errorf("%s: InspectKeyFile() = %v, want ErrKeyFileFormat", name, err)
+		}
+	}
+
+	if _, err := SealPrivkey(privkey, passphrase, KeyFileParams{Time: 1, MemoryKiB: keyFileMaxMemoryKiB + 1, Threads: 1}); err == nil {
+		t.Error("SealPrivkey() accepted parameters it can't open again")
+	}
+}
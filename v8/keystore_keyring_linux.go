@@ -0,0 +1,138 @@
+//go:build linux
+
+package norddrop
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// Special keyring IDs accepted by the keyring functions
+const (
+	KeyringSession = unix.KEY_SPEC_SESSION_KEYRING
+	KeyringUser    = unix.KEY_SPEC_USER_KEYRING
+)
+
+// Default description of the `user` key holding the private key
+const DefaultKeyringPrivkeyName = "norddrop:privkey"
+
+// Default description prefix of the `user` keys holding peer public keys. The
+// peer's IP address is appended to it.
+const DefaultKeyringPeerPrefix = "norddrop:peer:"
+
+// KeyStore reading keys from the Linux kernel keyring. Keys are stored as
+// `user` type keys with raw 32 byte payloads.
+type KeyringKeyStore struct {
+	ring        int
+	privkeyName string
+	peerPrefix  string
+}
+
+// Creates the keyring backed KeyStore with the default key names and checks
+// that the private key is present.
+//
+// # Arguments
+// * `ring` - Keyring to search, e.g. `KeyringSession` or `KeyringUser`
+func NewKeyringKeyStore(ring int) (*KeyringKeyStore, error) {
+	return NewKeyringKeyStoreNamed(ring, DefaultKeyringPrivkeyName, DefaultKeyringPeerPrefix)
+}
+
+// Same as `NewKeyringKeyStore()` but with custom key descriptions
+func NewKeyringKeyStoreNamed(ring int, privkeyName string, peerPrefix string) (*KeyringKeyStore, error) {
+	ks := &KeyringKeyStore{
+		ring:        ring,
+		privkeyName: privkeyName,
+		peerPrefix:  peerPrefix,
+	}
+
+	privkey, err := readKeyringKey(ring, privkeyName)
+	if err != nil {
+		return nil, fmt.Errorf("reading private key %q: %w", privkeyName, err)
+	}
+	zeroBytes(privkey)
+	return ks, nil
+}
+
+func (ks *KeyringKeyStore) OnPubkey(peer string) *[]byte {
+	pubkey, err := readKeyringKey(ks.ring, ks.peerPrefix+peer)
+	if err != nil {
+		return nil
+	}
+	return &pubkey
+}
+
+func (ks *KeyringKeyStore) Privkey() []byte {
+	privkey, err := readKeyringKey(ks.ring, ks.privkeyName)
+	if err != nil {
+		// libdrop reports `LibdropErrorInvalidPrivkey` for an empty key
+		return nil
+	}
+	return privkey
+}
+
+// Stores the private key in the keyring under `DefaultKeyringPrivkeyName`,
+// replacing the existing one. Returns the key serial number.
+func ProvisionKeyringPrivkey(ring int, privkey []byte) (int, error) {
+	return provisionKeyringKey(ring, DefaultKeyringPrivkeyName, privkey)
+}
+
+// Stores the peer's public key in the keyring, replacing the existing one.
+// Returns the key serial number.
+func ProvisionKeyringPubkey(ring int, peer string, pubkey []byte) (int, error) {
+	return provisionKeyringKey(ring, DefaultKeyringPeerPrefix+peer, pubkey)
+}
+
+// Unlinks the peer's public key from the keyring
+func RemoveKeyringPubkey(ring int, peer string) error {
+	return removeKeyringKey(ring, DefaultKeyringPeerPrefix+peer)
+}
+
+// Unlinks the private key from the keyring
+func RemoveKeyringPrivkey(ring int) error {
+	return removeKeyringKey(ring, DefaultKeyringPrivkeyName)
+}
+
+func provisionKeyringKey(ring int, name string, key []byte) (int, error) {
+	if len(key) != keyFileKeySize {
+		return 0, fmt.Errorf("key must be %d bytes, got %d", keyFileKeySize, len(key))
+	}
+	id, err := unix.AddKey("user", name, key, ring)
+	if err != nil {
+		return 0, fmt.Errorf("adding key %q: %w", name, err)
+	}
+	return id, nil
+}
+
+func removeKeyringKey(ring int, name string) error {
+	id, err := unix.KeyctlSearch(ring, "user", name, 0)
+	if err != nil {
+		return fmt.Errorf("searching key %q: %w", name, err)
+	}
+	ringID, err := unix.KeyctlGetKeyringID(ring, false)
+	if err != nil {
+		return err
+	}
+	_, err = unix.KeyctlInt(unix.KEYCTL_UNLINK, id, ringID, 0, 0)
+	return err
+}
+
+func readKeyringKey(ring int, name string) ([]byte, error) {
+	id, err := unix.KeyctlSearch(ring, "user", name, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	// The payload size is returned even if the buffer is too small, so a
+	// single read with a key sized buffer is enough for valid keys
+	buf := make([]byte, keyFileKeySize)
+	n, err := unix.KeyctlBuffer(unix.KEYCTL_READ, id, buf, 0)
+	if err != nil {
+		return nil, err
+	}
+	if n != keyFileKeySize {
+		zeroBytes(buf)
+		return nil, fmt.Errorf("key %q has %d bytes, expected %d", name, n, keyFileKeySize)
+	}
+	return buf, nil
+}
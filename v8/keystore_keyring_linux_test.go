@@ -0,0 +1,107 @@
+//go:build linux
+
+package norddrop
+
+import (
+	"bytes"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+const keyringTestPeer = "192.0.2.1"
+
+// Skips unless the session keyring is usable and holds no private key which
+// the test would replace
+func requireSessionKeyring(t *testing.T) {
+	t.Helper()
+	if _, err := unix.KeyctlGetKeyringID(KeyringSession, false); err != nil {
+		t.Skipf("no session keyring: %v", err)
+	}
+	if _, err := unix.KeyctlSearch(KeyringSession, "user", DefaultKeyringPrivkeyName, 0); err == nil {
+		t.Skipf("session keyring already holds %q", DefaultKeyringPrivkeyName)
+	}
+}
+
+func TestKeyringKeyStore(t *testing.T) {
+	requireSessionKeyring(t)
+
+	privkey := bytes.Repeat([]byte{1}, keyFileKeySize)
+	pubkey := bytes.Repeat([]byte{2}, keyFileKeySize)
+
+	if _, err := ProvisionKeyringPrivkey(KeyringSession, privkey); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := RemoveKeyringPrivkey(KeyringSession); err != nil {
+			t.Error(err)
+		}
+	})
+	if _, err := ProvisionKeyringPubkey(KeyringSession, keyringTestPeer, pubkey); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := RemoveKeyringPubkey(KeyringSession, keyringTestPeer); err != nil {
+			t.Error(err)
+		}
+	})
+
+	ks, err := NewKeyringKeyStore(KeyringSession)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ks.Privkey(); !bytes.Equal(got, privkey) {
+		t.Errorf("Privkey() = %x, want %x", got, privkey)
+	}
+	if got := ks.OnPubkey(keyringTestPeer); got == nil || !bytes.Equal(*got, pubkey) {
+		t.Errorf("OnPubkey(%q) = %v, want %x", keyringTestPeer, got, pubkey)
+	}
+	if got := ks.OnPubkey("192.0.2.2"); got != nil {
+		t.Errorf("OnPubkey() of unknown peer = %x, want nil", *got)
+	}
+}
+
+func TestKeyringKeyStoreShortKey(t *testing.T) {
+	requireSessionKeyring(t)
+
+	short := bytes.Repeat([]byte{3}, keyFileKeySize-1)
+	if _, err := ProvisionKeyringPrivkey(KeyringSession, short); err == nil {
+		t.Error("ProvisionKeyringPrivkey() accepted a 31 byte key")
+	}
+	if _, err := ProvisionKeyringPubkey(KeyringSession, keyringTestPeer, short); err == nil {
+		t.Error("ProvisionKeyringPubkey() accepted a 31 byte key")
+	}
+
+	// Keys added by other tools are checked when read
+	if _, err := unix.AddKey("user", DefaultKeyringPrivkeyName, short, KeyringSession); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := RemoveKeyringPrivkey(KeyringSession); err != nil {
+			t.Error(err)
+		}
+	})
+	if _, err := unix.AddKey("user", DefaultKeyringPeerPrefix+keyringTestPeer, short, KeyringSession); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := RemoveKeyringPubkey(KeyringSession, keyringTestPeer); err != nil {
+			t.Error(err)
+		}
+	})
+
+	if _, err := NewKeyringKeyStore(KeyringSession); err == nil {
+		t.Error("NewKeyringKeyStore() accepted a 31 byte private key")
+	}
+	ks := &KeyringKeyStore{
+		ring:        KeyringSession,
+		privkeyName: DefaultKeyringPrivkeyName,
+		peerPrefix:  DefaultKeyringPeerPrefix,
+	}
+	if got := ks.Privkey(); got != nil {
+		t.Errorf("Privkey() = %x, want nil", got)
+	}
+	if got := ks.OnPubkey(keyringTestPeer); got != nil {
+		t.Errorf("OnPubkey() = %x, want nil", *got)
+	}
+}
@@ -0,0 +1,212 @@
+package norddrop
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+)
+
+// A `[Peer]` section of a WireGuard config file
+type WireGuardPeer struct {
+	// Decoded 32 byte public key
+	PublicKey []byte
+	// Networks routed to the peer
+	AllowedIPs []netip.Prefix
+}
+
+// The parts of a WireGuard config file relevant for libdrop
+type WireGuardConfig struct {
+	// Decoded 32 byte `[Interface]` private key, `nil` if not present
+	PrivateKey []byte
+	// All `[Peer]` sections
+	Peers []WireGuardPeer
+}
+
+// Parses a WireGuard (`wg` or `wg-quick`) config file. Keys other than
+// `PrivateKey`, `PublicKey` and `AllowedIPs` are ignored.
+func ParseWireGuardConfig(r io.Reader) (*WireGuardConfig, error) {
+	config := &WireGuardConfig{}
+	var peer *WireGuardPeer
+	section := ""
+
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.ToLower(strings.TrimSpace(line[1 : len(line)-1]))
+			if section == "peer" {
+				config.Peers = append(config.Peers, WireGuardPeer{})
+				peer = &config.Peers[len(config.Peers)-1]
+			}
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key = value", lineNo)
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch {
+		case section == "interface" && key == "privatekey":
+			privkey, err := decodeWireGuardKey(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: PrivateKey: %w", lineNo, err)
+			}
+			config.PrivateKey = privkey
+		case section == "peer" && key == "publickey":
+			pubkey, err := decodeWireGuardKey(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: PublicKey: %w", lineNo, err)
+			}
+			peer.PublicKey = pubkey
+		case section == "peer" && key == "allowedips":
+			for _, item := range strings.Split(value, ",") {
+				item = strings.TrimSpace(item)
+				if item == "" {
+					continue
+				}
+				prefix, err := netip.ParsePrefix(item)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: AllowedIPs: %w", lineNo, err)
+				}
+				peer.AllowedIPs = append(peer.AllowedIPs, prefix.Masked())
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for i, peer := range config.Peers {
+		if peer.PublicKey == nil {
+			return nil, fmt.Errorf("[Peer] section %d has no PublicKey", i+1)
+		}
+	}
+	return config, nil
+}
+
+func decodeWireGuardKey(value string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != keyFileKeySize {
+		return nil, fmt.Errorf("key must be %d bytes, got %d", keyFileKeySize, len(key))
+	}
+	return key, nil
+}
+
+// KeyStore answering from WireGuard config files. The peer's public key is
+// found by matching its IP address against the `AllowedIPs` of every
+// `[Peer]`, the most specific prefix wins. The private key is the
+// `[Interface]` `PrivateKey`.
+type WireGuardKeyStore struct {
+	paths []string
+
+	mu      sync.RWMutex
+	privkey []byte
+	peers   []WireGuardPeer
+}
+
+// Loads the given config files. Exactly one distinct `[Interface]`
+// `PrivateKey` must be present among them.
+func NewWireGuardKeyStore(paths ...string) (*WireGuardKeyStore, error) {
+	ks := &WireGuardKeyStore{paths: paths}
+	if err := ks.Reload(); err != nil {
+		return nil, err
+	}
+	return ks, nil
+}
+
+// Re-reads the config files. The previous state is kept if any file fails to
+// load.
+func (ks *WireGuardKeyStore) Reload() error {
+	var privkey []byte
+	var peers []WireGuardPeer
+
+	for _, path := range ks.paths {
+		config, err := loadWireGuardConfig(path)
+		if err != nil {
+			return err
+		}
+		if config.PrivateKey != nil {
+			if privkey != nil && string(privkey) != string(config.PrivateKey) {
+				return fmt.Errorf("%s: conflicting [Interface] PrivateKey", path)
+			}
+			privkey = config.PrivateKey
+		}
+		peers = append(peers, config.Peers...)
+	}
+	if privkey == nil {
+		return fmt.Errorf("no [Interface] PrivateKey in %s", strings.Join(ks.paths, ", "))
+	}
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	zeroBytes(ks.privkey)
+	ks.privkey = privkey
+	ks.peers = peers
+	return nil
+}
+
+func loadWireGuardConfig(path string) (*WireGuardConfig, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	config, err := ParseWireGuardConfig(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return config, nil
+}
+
+func (ks *WireGuardKeyStore) OnPubkey(peer string) *[]byte {
+	addr, err := netip.ParseAddr(strings.Trim(peer, "[]"))
+	if err != nil {
+		return nil
+	}
+	addr = addr.Unmap().WithZone("")
+
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	var found []byte
+	bits := -1
+	for _, p := range ks.peers {
+		for _, prefix := range p.AllowedIPs {
+			if prefix.Bits() > bits && prefix.Contains(addr) {
+				found = p.PublicKey
+				bits = prefix.Bits()
+			}
+		}
+	}
+	if found == nil {
+		return nil
+	}
+	pubkey := append([]byte(nil), found...)
+	return &pubkey
+}
+
+func (ks *WireGuardKeyStore) Privkey() []byte {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	return append([]byte(nil), ks.privkey...)
+}
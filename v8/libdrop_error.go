@@ -0,0 +1,146 @@
+package norddrop
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Variant of a `LibdropError`, the values match the libdrop error codes
+type LibdropErrorKind uint
+
+const (
+	LibdropErrorKindUnknown        LibdropErrorKind = 1
+	LibdropErrorKindInvalidString  LibdropErrorKind = 2
+	LibdropErrorKindBadInput       LibdropErrorKind = 3
+	LibdropErrorKindTransferCreate LibdropErrorKind = 4
+	LibdropErrorKindNotStarted     LibdropErrorKind = 5
+	LibdropErrorKindAddrInUse      LibdropErrorKind = 6
+	LibdropErrorKindInstanceStart  LibdropErrorKind = 7
+	LibdropErrorKindInstanceStop   LibdropErrorKind = 8
+	LibdropErrorKindInvalidPrivkey LibdropErrorKind = 9
+	LibdropErrorKindDbError        LibdropErrorKind = 10
+)
+
+func (k LibdropErrorKind) String() string {
+	switch k {
+	case LibdropErrorKindUnknown:
+		return "Unknown"
+	case LibdropErrorKindInvalidString:
+		return "InvalidString"
+	case LibdropErrorKindBadInput:
+		return "BadInput"
+	case LibdropErrorKindTransferCreate:
+		return "TransferCreate"
+	case LibdropErrorKindNotStarted:
+		return "NotStarted"
+	case LibdropErrorKindAddrInUse:
+		return "AddrInUse"
+	case LibdropErrorKindInstanceStart:
+		return "InstanceStart"
+	case LibdropErrorKindInstanceStop:
+		return "InstanceStop"
+	case LibdropErrorKindInvalidPrivkey:
+		return "InvalidPrivkey"
+	case LibdropErrorKindDbError:
+		return "DbError"
+	default:
+		return fmt.Sprintf("LibdropErrorKind(%d)", uint(k))
+	}
+}
+
+// Returns the variant of the error, the raw error code for
+// `LibdropErrorUnrecognized`
+func (err LibdropError) Kind() LibdropErrorKind {
+	switch e := err.err.(type) {
+	case *LibdropErrorUnknown:
+		return LibdropErrorKindUnknown
+	case *LibdropErrorInvalidString:
+		return LibdropErrorKindInvalidString
+	case *LibdropErrorBadInput:
+		return LibdropErrorKindBadInput
+	case *LibdropErrorTransferCreate:
+		return LibdropErrorKindTransferCreate
+	case *LibdropErrorNotStarted:
+		return LibdropErrorKindNotStarted
+	case *LibdropErrorAddrInUse:
+		return LibdropErrorKindAddrInUse
+	case *LibdropErrorInstanceStart:
+		return LibdropErrorKindInstanceStart
+	case *LibdropErrorInstanceStop:
+		return LibdropErrorKindInstanceStop
+	case *LibdropErrorInvalidPrivkey:
+		return LibdropErrorKindInvalidPrivkey
+	case *LibdropErrorDbError:
+		return LibdropErrorKindDbError
+	case *LibdropErrorUnrecognized:
+		return LibdropErrorKind(e.code)
+	default:
+		return 0
+	}
+}
+
+// Returns the message libdrop attached to the error
+func (err LibdropError) Message() string {
+	if m, ok := err.err.(interface{ Message() string }); ok {
+		return m.Message()
+	}
+	return ""
+}
+
+// Returns the call the error was returned from, `nil` if unknown
+func (err LibdropError) Call() *LibdropCall {
+	return err.call
+}
+
+func (err LibdropErrorUnknown) Message() string        { return err.message }
+func (err LibdropErrorInvalidString) Message() string  { return err.message }
+func (err LibdropErrorBadInput) Message() string       { return err.message }
+func (err LibdropErrorTransferCreate) Message() string { return err.message }
+func (err LibdropErrorNotStarted) Message() string     { return err.message }
+func (err LibdropErrorAddrInUse) Message() string      { return err.message }
+func (err LibdropErrorInstanceStart) Message() string  { return err.message }
+func (err LibdropErrorInstanceStop) Message() string   { return err.message }
+func (err LibdropErrorInvalidPrivkey) Message() string { return err.message }
+func (err LibdropErrorDbError) Message() string        { return err.message }
+
+// A `NordDrop` method call which failed
+type LibdropCall struct {
+	Method string
+	Args   []LibdropCallArg
+}
+
+// Named argument of a `LibdropCall`
+type LibdropCallArg struct {
+	Name  string
+	Value any
+}
+
+// Formats the call as `Method(name="value", ...)`
+func (c *LibdropCall) String() string {
+	args := make([]string, len(c.Args))
+	for i, arg := range c.Args {
+		switch v := arg.Value.(type) {
+		case string:
+			args[i] = fmt.Sprintf("%s=%q", arg.Name, v)
+		default:
+			args[i] = fmt.Sprintf("%s=%v", arg.Name, v)
+		}
+	}
+	return fmt.Sprintf("%s(%s)", c.Method, strings.Join(args, ", "))
+}
+
+// Attaches the call to a `*LibdropError`, other errors are returned as is.
+// `args` alternate argument names and values.
+func withLibdropCall(err error, method string, args ...any) error {
+	libdropErr, ok := err.(*LibdropError)
+	if !ok {
+		return err
+	}
+
+	call := &LibdropCall{Method: method}
+	for i := 0; i+1 < len(args); i += 2 {
+		call.Args = append(call.Args, LibdropCallArg{Name: fmt.Sprint(args[i]), Value: args[i+1]})
+	}
+	libdropErr.call = call
+	return libdropErr
+}
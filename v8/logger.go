@@ -0,0 +1,52 @@
+package norddrop
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+func (l LogLevel) String() string {
+	switch l {
+	case LogLevelCritical:
+		return "CRITICAL"
+	case LogLevelError:
+		return "ERROR"
+	case LogLevelWarning:
+		return "WARNING"
+	case LogLevelInfo:
+		return "INFO"
+	case LogLevelDebug:
+		return "DEBUG"
+	case LogLevelTrace:
+		return "TRACE"
+	default:
+		return fmt.Sprintf("LogLevel(%d)", uint(l))
+	}
+}
+
+// A libdrop log message split into the parts libdrop puts into it
+type logMessage struct {
+	// Rust module path, e.g. `drop_transfer::ws::server`, empty if missing
+	module string
+	// Transfer UUIDs mentioned in the message
+	transferIds []string
+	// The message without the module prefix
+	text string
+}
+
+var (
+	// Either `[module::path] text` or `module::path: text`
+	logModulePrefix = regexp.MustCompile(`^(?:\[([A-Za-z_][A-Za-z0-9_]*(?:::[A-Za-z0-9_]+)+)\]\s*|([A-Za-z_][A-Za-z0-9_]*(?:::[A-Za-z0-9_]+)+):\s+)`)
+	logUuid         = regexp.MustCompile(`\b[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}\b`)
+)
+
+func parseLogMessage(msg string) logMessage {
+	parsed := logMessage{text: msg}
+	if m := logModulePrefix.FindStringSubmatch(msg); m != nil {
+		parsed.module = m[1] + m[2]
+		parsed.text = strings.TrimSpace(msg[len(m[0]):])
+	}
+	parsed.transferIds = logUuid.FindAllString(parsed.text, -1)
+	return parsed
+}
@@ -0,0 +1,146 @@
+package norddrop
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+type moduleLogRule struct {
+	prefix  string
+	level   LogLevel
+	exclude bool
+}
+
+// Logger decorator whose verbosity can be changed while libdrop is running.
+// Besides the global level, rules for Rust module path prefixes can raise
+// or lower the level of a single subsystem or silence it completely. The
+// most specific matching prefix wins.
+type DynamicLogger struct {
+	next  Logger
+	level atomic.Uint32
+
+	mu    sync.Mutex
+	rules atomic.Pointer[[]moduleLogRule]
+}
+
+// # Arguments
+// * `next` - Logger receiving the messages that pass the filter
+// * `level` - Initial global level
+func NewDynamicLogger(next Logger, level LogLevel) *DynamicLogger {
+	l := &DynamicLogger{next: next}
+	l.level.Store(uint32(level))
+	l.rules.Store(&[]moduleLogRule{})
+	return l
+}
+
+func (l *DynamicLogger) wrapped() []any {
+	return []any{l.next}
+}
+
+// Sets the global level used for modules without a rule
+func (l *DynamicLogger) SetLevel(level LogLevel) {
+	l.level.Store(uint32(level))
+}
+
+// Returns the global level
+func (l *DynamicLogger) GlobalLevel() LogLevel {
+	return LogLevel(l.level.Load())
+}
+
+// Sets the level of the modules starting with the prefix, e.g.
+// `drop_transfer::ws` covers `drop_transfer::ws::server` as well
+func (l *DynamicLogger) SetModuleLevel(prefix string, level LogLevel) {
+	l.setRule(moduleLogRule{prefix: prefix, level: level})
+}
+
+// Drops all messages of the modules starting with the prefix
+func (l *DynamicLogger) ExcludeModule(prefix string) {
+	l.setRule(moduleLogRule{prefix: prefix, exclude: true})
+}
+
+// Removes the rule for the prefix, the module falls back to the global level
+func (l *DynamicLogger) ClearModule(prefix string) {
+	l.updateRules(func(rules []moduleLogRule) []moduleLogRule {
+		kept := rules[:0]
+		for _, rule := range rules {
+			if rule.prefix != prefix {
+				kept = append(kept, rule)
+			}
+		}
+		return kept
+	})
+}
+
+// Removes all module rules
+func (l *DynamicLogger) ClearModules() {
+	l.updateRules(func([]moduleLogRule) []moduleLogRule { return nil })
+}
+
+func (l *DynamicLogger) setRule(rule moduleLogRule) {
+	l.updateRules(func(rules []moduleLogRule) []moduleLogRule {
+		for i := range rules {
+			if rules[i].prefix == rule.prefix {
+				rules[i] = rule
+				return rules
+			}
+		}
+		return append(rules, rule)
+	})
+}
+
+// Rules are copied on write so that `OnLog()` never takes the lock
+func (l *DynamicLogger) updateRules(update func([]moduleLogRule) []moduleLogRule) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	rules := append([]moduleLogRule(nil), *l.rules.Load()...)
+	rules = update(rules)
+	l.rules.Store(&rules)
+}
+
+func (l *DynamicLogger) OnLog(level LogLevel, msg string) {
+	if level <= l.moduleLevel(parseLogMessage(msg).module) {
+		l.next.OnLog(level, msg)
+	}
+}
+
+// Returns the level applying to the module, zero if the module is excluded
+func (l *DynamicLogger) moduleLevel(module string) LogLevel {
+	var match *moduleLogRule
+	rules := *l.rules.Load()
+	for i := range rules {
+		rule := &rules[i]
+		if modulePathHasPrefix(module, rule.prefix) && (match == nil || len(rule.prefix) > len(match.prefix)) {
+			match = rule
+		}
+	}
+
+	switch {
+	case match == nil:
+		return l.GlobalLevel()
+	case match.exclude:
+		return 0
+	default:
+		return match.level
+	}
+}
+
+func modulePathHasPrefix(module string, prefix string) bool {
+	if !strings.HasPrefix(module, prefix) {
+		return false
+	}
+	return len(module) == len(prefix) || strings.HasPrefix(module[len(prefix):], "::")
+}
+
+// The most verbose level any module currently needs. libdrop uses it to
+// skip formatting messages that would be dropped anyway.
+func (l *DynamicLogger) Level() LogLevel {
+	level := l.GlobalLevel()
+	for _, rule := range *l.rules.Load() {
+		if !rule.exclude && rule.level > level {
+			level = rule.level
+		}
+	}
+	return level
+}
@@ -0,0 +1,376 @@
+package norddrop
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Line format of `FileLogger`
+type LogFormat int
+
+const (
+	// `<time> <LEVEL> <message>`
+	LogFormatText LogFormat = iota
+	// `time=<time> level=<LEVEL> module=<module> msg=<message>`
+	LogFormatLogfmt
+	// One JSON object per line with `time`, `level`, `module` and `msg`
+	LogFormatJSON
+)
+
+const (
+	defaultFileLoggerMaxSize    = 10 << 20
+	defaultFileLoggerBufferSize = 1024
+	fileLoggerBackupTimeFormat  = "20060102T150405.000"
+)
+
+// Configuration of `FileLogger`
+type FileLoggerConfig struct {
+	// Log file path. Rotated files are placed next to it with a timestamp
+	// suffix.
+	Path string
+	// Maximum log level written
+	Level LogLevel
+	// Line format
+	Format LogFormat
+	// Rotate once the file reaches this many bytes, 10 MiB if zero
+	MaxSize int64
+	// Rotate once the file is older than this and delete older rotated files.
+	// Zero disables age based rotation.
+	MaxAge time.Duration
+	// Maximum number of rotated files kept, zero keeps all
+	MaxBackups int
+	// Cap on the size of the log file and all rotated files together, zero
+	// disables the cap. The oldest rotated files are deleted first.
+	MaxTotalSize int64
+	// Gzip rotated files
+	Compress bool
+	// Number of lines queued for the writer, 1024 if zero. Lines are dropped
+	// when the queue is full.
+	BufferSize int
+}
+
+type fileLogEntry struct {
+	time  time.Time
+	level LogLevel
+	msg   string
+}
+
+// Logger writing libdrop logs to a size and age rotated file. `OnLog()` only
+// queues the line, the file is written from a separate goroutine so libdrop
+// threads never wait for the disk.
+type FileLogger struct {
+	config  FileLoggerConfig
+	entries chan fileLogEntry
+	done    chan struct{}
+	dropped atomic.Uint64
+
+	closeMu sync.RWMutex
+	closed  bool
+
+	file   *os.File
+	size   int64
+	opened time.Time
+	err    error
+}
+
+// Opens the log file for appending and starts the writer goroutine
+func NewFileLogger(config FileLoggerConfig) (*FileLogger, error) {
+	if config.MaxSize <= 0 {
+		config.MaxSize = defaultFileLoggerMaxSize
+	}
+	if config.BufferSize <= 0 {
+		config.BufferSize = defaultFileLoggerBufferSize
+	}
+
+	l := &FileLogger{
+		config:  config,
+		entries: make(chan fileLogEntry, config.BufferSize),
+		done:    make(chan struct{}),
+	}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	go l.run()
+	return l, nil
+}
+
+func (l *FileLogger) OnLog(level LogLevel, msg string) {
+	if level > l.config.Level {
+		return
+	}
+
+	l.closeMu.RLock()
+	defer l.closeMu.RUnlock()
+	if l.closed {
+		return
+	}
+
+	select {
+	case l.entries <- fileLogEntry{time: time.Now(), level: level, msg: msg}:
+	default:
+		l.dropped.Add(1)
+	}
+}
+
+func (l *FileLogger) Level() LogLevel {
+	return l.config.Level
+}
+
+// Number of lines dropped because the queue was full
+func (l *FileLogger) Dropped() uint64 {
+	return l.dropped.Load()
+}
+
+// Writes out the queued lines and closes the file. Returns the first write
+// error encountered by the writer, if any.
+func (l *FileLogger) Close() error {
+	l.closeMu.Lock()
+	if l.closed {
+		l.closeMu.Unlock()
+		return nil
+	}
+	l.closed = true
+	close(l.entries)
+	l.closeMu.Unlock()
+
+	<-l.done
+	if err := l.file.Close(); err != nil && l.err == nil {
+		l.err = err
+	}
+	return l.err
+}
+
+func (l *FileLogger) run() {
+	defer close(l.done)
+
+	var reported uint64
+	var buf []byte
+	for entry := range l.entries {
+		if dropped := l.dropped.Load(); dropped != reported {
+			buf = l.format(buf[:0], fileLogEntry{
+				time:  entry.time,
+				level: LogLevelWarning,
+				msg:   fmt.Sprintf("%d log lines dropped, the writer cannot keep up", dropped-reported),
+			})
+			l.write(buf)
+			reported = dropped
+		}
+		buf = l.format(buf[:0], entry)
+		l.write(buf)
+	}
+}
+
+func (l *FileLogger) write(line []byte) {
+	if l.size+int64(len(line)) > l.config.MaxSize && l.size > 0 ||
+		l.config.MaxAge > 0 && time.Since(l.opened) > l.config.MaxAge {
+		l.setErr(l.rotate())
+	}
+	n, err := l.file.Write(line)
+	l.size += int64(n)
+	l.setErr(err)
+}
+
+func (l *FileLogger) setErr(err error) {
+	if err != nil && l.err == nil {
+		l.err = err
+	}
+}
+
+func (l *FileLogger) format(buf []byte, entry fileLogEntry) []byte {
+	ts := entry.time.UTC().Format(time.RFC3339Nano)
+	switch l.config.Format {
+	case LogFormatLogfmt:
+		parsed := parseLogMessage(entry.msg)
+		buf = append(buf, "time="...)
+		buf = append(buf, ts...)
+		buf = append(buf, " level="...)
+		buf = append(buf, entry.level.String()...)
+		if parsed.module != "" {
+			buf = append(buf, " module="...)
+			buf = append(buf, parsed.module...)
+		}
+		buf = append(buf, " msg="...)
+		buf = appendLogfmtValue(buf, parsed.text)
+	case LogFormatJSON:
+		parsed := parseLogMessage(entry.msg)
+		line, _ := json.Marshal(struct {
+			Time   string `json:"time"`
+			Level  string `json:"level"`
+			Module string `json:"module,omitempty"`
+			Msg    string `json:"msg"`
+		}{ts, entry.level.String(), parsed.module, parsed.text})
+		buf = append(buf, line...)
+	default:
+		buf = append(buf, ts...)
+		buf = append(buf, ' ')
+		buf = append(buf, entry.level.String()...)
+		buf = append(buf, ' ')
+		buf = append(buf, entry.msg...)
+	}
+	return append(buf, '\n')
+}
+
+func appendLogfmtValue(buf []byte, value string) []byte {
+	if value == "" || strings.ContainsAny(value, " =\"\\") || strings.IndexFunc(value, func(r rune) bool { return r < ' ' }) >= 0 {
+		return strconv.AppendQuote(buf, value)
+	}
+	return append(buf, value...)
+}
+
+func (l *FileLogger) open() error {
+	file, err := os.OpenFile(l.config.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o640)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	l.file = file
+	l.size = info.Size()
+	l.opened = time.Now()
+	if l.size > 0 {
+		// The file outlived a restart. It was started by the last rotation,
+		// or, if it never rotated, at least by its last write.
+		l.opened = info.ModTime()
+		if backups, err := l.backups(); err == nil && len(backups) > 0 && backups[0].created.Before(l.opened) {
+			l.opened = backups[0].created
+		}
+	}
+	return nil
+}
+
+// Returns the path of the next rotated file. Rotations within the same
+// millisecond move the timestamp on, so no backup is overwritten.
+func (l *FileLogger) backupPath(now time.Time) string {
+	for ts := now.UTC(); ; ts = ts.Add(time.Millisecond) {
+		backup := l.config.Path + "." + ts.Format(fileLoggerBackupTimeFormat)
+		if !fileExists(backup) && !fileExists(backup+".gz") {
+			return backup
+		}
+	}
+}
+
+func fileExists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+func (l *FileLogger) rotate() error {
+	if err := l.file.Close(); err != nil {
+		return err
+	}
+
+	backup := l.backupPath(time.Now())
+	renameErr := os.Rename(l.config.Path, backup)
+	if err := l.open(); err != nil {
+		return err
+	}
+	if renameErr != nil {
+		return renameErr
+	}
+
+	var compressErr error
+	if l.config.Compress {
+		compressErr = gzipFile(backup)
+	}
+	if err := l.cleanup(); err != nil {
+		return err
+	}
+	return compressErr
+}
+
+func gzipFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+".gz", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o640)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	if _, err := io.Copy(zw, src); err != nil {
+		dst.Close()
+		os.Remove(dst.Name())
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		dst.Close()
+		os.Remove(dst.Name())
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(dst.Name())
+		return err
+	}
+	return os.Remove(path)
+}
+
+type fileLoggerBackup struct {
+	path    string
+	size    int64
+	created time.Time
+}
+
+// Lists the rotated files, newest first
+func (l *FileLogger) backups() ([]fileLoggerBackup, error) {
+	matches, err := filepath.Glob(l.config.Path + ".*")
+	if err != nil {
+		return nil, err
+	}
+
+	var backups []fileLoggerBackup
+	prefix := l.config.Path + "."
+	for _, match := range matches {
+		stamp := strings.TrimSuffix(strings.TrimPrefix(match, prefix), ".gz")
+		created, err := time.Parse(fileLoggerBackupTimeFormat, stamp)
+		if err != nil {
+			continue
+		}
+		info, err := os.Stat(match)
+		if err != nil {
+			continue
+		}
+		backups = append(backups, fileLoggerBackup{match, info.Size(), created})
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].created.After(backups[j].created) })
+	return backups, nil
+}
+
+// Deletes rotated files exceeding `MaxBackups`, `MaxAge` or `MaxTotalSize`
+func (l *FileLogger) cleanup() error {
+	backups, err := l.backups()
+	if err != nil {
+		return err
+	}
+
+	total := l.size
+	var firstErr error
+	for i, b := range backups {
+		total += b.size
+		expired := l.config.MaxAge > 0 && time.Since(b.created) > l.config.MaxAge
+		tooMany := l.config.MaxBackups > 0 && i >= l.config.MaxBackups
+		tooBig := l.config.MaxTotalSize > 0 && total > l.config.MaxTotalSize
+		if expired || tooMany || tooBig {
+			if err := os.Remove(b.path); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
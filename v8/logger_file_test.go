@@ -0,0 +1,66 @@
+package norddrop
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileLoggerAgeSurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "drop.log")
+	started := time.Now().Add(-2 * time.Hour)
+	backup := path + "." + started.UTC().Format(fileLoggerBackupTimeFormat)
+	if err := os.WriteFile(backup, []byte("old\n"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("current\n"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+
+	logger, err := NewFileLogger(FileLoggerConfig{Path: path, Level: LogLevelInfo, MaxAge: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.OnLog(LogLevelInfo, "after restart")
+	if err := logger.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) == "current\n" || len(data) == 0 {
+		t.Fatalf("log holds %q", data)
+	}
+	backups, err := filepath.Glob(path + ".*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The two hours old backup expired, the file it was rotated from is kept
+	if len(backups) != 1 || backups[0] == backup {
+		t.Errorf("backups = %v, want the rotated current file only", backups)
+	}
+}
+
+func TestFileLoggerBackupPathUnique(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "drop.log")
+	l := &FileLogger{config: FileLoggerConfig{Path: path}}
+
+	now := time.Now()
+	first := l.backupPath(now)
+	if err := os.WriteFile(first, nil, 0o640); err != nil {
+		t.Fatal(err)
+	}
+	second := l.backupPath(now)
+	if second == first {
+		t.Fatalf("backup path %s reused", first)
+	}
+	if err := os.WriteFile(second+".gz", nil, 0o640); err != nil {
+		t.Fatal(err)
+	}
+	if third := l.backupPath(now); third == first || third == second {
+		t.Errorf("backup path %s reused", third)
+	}
+}
@@ -0,0 +1,103 @@
+package norddrop
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Path of the journald native protocol socket
+const DefaultJournaldSocket = "/run/systemd/journal/socket"
+
+// Logger sending entries to journald over its native socket protocol.
+// Besides `MESSAGE` and `PRIORITY` every entry carries `LIBDROP_LEVEL` and,
+// when present in the message, `LIBDROP_MODULE` and `LIBDROP_TRANSFER_ID`.
+type JournaldLogger struct {
+	identifier string
+	level      LogLevel
+
+	mu   sync.Mutex
+	conn *net.UnixConn
+}
+
+// # Arguments
+// * `socket` - Socket path, `DefaultJournaldSocket` if empty
+// * `identifier` - `SYSLOG_IDENTIFIER` field, `norddrop` if empty
+// * `level` - Maximum log level sent
+func NewJournaldLogger(socket string, identifier string, level LogLevel) (*JournaldLogger, error) {
+	if socket == "" {
+		socket = DefaultJournaldSocket
+	}
+	if identifier == "" {
+		identifier = "norddrop"
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+	return &JournaldLogger{
+		identifier: identifier,
+		level:      level,
+		conn:       conn,
+	}, nil
+}
+
+func (l *JournaldLogger) OnLog(level LogLevel, msg string) {
+	if level > l.level {
+		return
+	}
+	parsed := parseLogMessage(msg)
+
+	var b bytes.Buffer
+	writeJournaldField(&b, "MESSAGE", parsed.text)
+	writeJournaldField(&b, "PRIORITY", strconv.Itoa(SyslogSeverity(level)))
+	writeJournaldField(&b, "SYSLOG_IDENTIFIER", l.identifier)
+	writeJournaldField(&b, "SYSLOG_PID", strconv.Itoa(os.Getpid()))
+	writeJournaldField(&b, "LIBDROP_LEVEL", level.String())
+	if parsed.module != "" {
+		writeJournaldField(&b, "LIBDROP_MODULE", parsed.module)
+	}
+	if len(parsed.transferIds) > 0 {
+		writeJournaldField(&b, "LIBDROP_TRANSFER_ID", strings.Join(parsed.transferIds, " "))
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.conn != nil {
+		_, _ = l.conn.Write(b.Bytes())
+	}
+}
+
+func (l *JournaldLogger) Level() LogLevel {
+	return l.level
+}
+
+func (l *JournaldLogger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.conn == nil {
+		return nil
+	}
+	err := l.conn.Close()
+	l.conn = nil
+	return err
+}
+
+// Values with newlines use the binary form: the name, a newline, the
+// little endian 64 bit length and the raw value
+func writeJournaldField(b *bytes.Buffer, name string, value string) {
+	b.WriteString(name)
+	if strings.ContainsRune(value, '\n') {
+		b.WriteByte('\n')
+		_ = binary.Write(b, binary.LittleEndian, uint64(len(value)))
+	} else {
+		b.WriteByte('=')
+	}
+	b.WriteString(value)
+	b.WriteByte('\n')
+}
@@ -0,0 +1,83 @@
+//go:build unix
+
+package norddrop
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func journaldTestServer(t *testing.T) (*net.UnixConn, string) {
+	t.Helper()
+	sock := filepath.Join(t.TempDir(), "socket")
+	server, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: sock, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { server.Close() })
+	return server, sock
+}
+
+func readJournaldEntry(t *testing.T, server *net.UnixConn) []byte {
+	t.Helper()
+	buf := make([]byte, 4096)
+	server.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, err := server.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf[:n]
+}
+
+func TestJournaldLogger(t *testing.T) {
+	server, sock := journaldTestServer(t)
+	logger, err := NewJournaldLogger(sock, "", LogLevelInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+
+	logger.OnLog(LogLevelDebug, "filtered out")
+	logger.OnLog(LogLevelWarning, "[drop_transfer::ws] Transfer 3fa85f64-5717-4562-b3fc-2c963f66afa6 stalled")
+
+	want := "MESSAGE=Transfer 3fa85f64-5717-4562-b3fc-2c963f66afa6 stalled\n" +
+		"PRIORITY=4\n" +
+		"SYSLOG_IDENTIFIER=norddrop\n" +
+		"SYSLOG_PID=" + strconv.Itoa(os.Getpid()) + "\n" +
+		"LIBDROP_LEVEL=WARNING\n" +
+		"LIBDROP_MODULE=drop_transfer::ws\n" +
+		"LIBDROP_TRANSFER_ID=3fa85f64-5717-4562-b3fc-2c963f66afa6\n"
+	if got := string(readJournaldEntry(t, server)); got != want {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+}
+
+func TestJournaldLoggerMultiline(t *testing.T) {
+	server, sock := journaldTestServer(t)
+	logger, err := NewJournaldLogger(sock, "app", LogLevelTrace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+
+	msg := "first line\nsecond line"
+	logger.OnLog(LogLevelCritical, msg)
+
+	var want bytes.Buffer
+	want.WriteString("MESSAGE\n")
+	binary.Write(&want, binary.LittleEndian, uint64(len(msg)))
+	want.WriteString(msg + "\n")
+	want.WriteString("PRIORITY=2\n" +
+		"SYSLOG_IDENTIFIER=app\n" +
+		"SYSLOG_PID=" + strconv.Itoa(os.Getpid()) + "\n" +
+		"LIBDROP_LEVEL=CRITICAL\n")
+	if got := readJournaldEntry(t, server); !bytes.Equal(got, want.Bytes()) {
+		t.Errorf("got  %q\nwant %q", got, want.Bytes())
+	}
+}
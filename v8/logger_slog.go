@@ -0,0 +1,92 @@
+package norddrop
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// Custom slog levels for the libdrop levels without a slog counterpart
+const (
+	SlogLevelTrace    = slog.Level(-8)
+	SlogLevelCritical = slog.Level(12)
+)
+
+// Maps the libdrop log level onto the slog level
+func SlogLevel(level LogLevel) slog.Level {
+	switch level {
+	case LogLevelCritical:
+		return SlogLevelCritical
+	case LogLevelError:
+		return slog.LevelError
+	case LogLevelWarning:
+		return slog.LevelWarn
+	case LogLevelInfo:
+		return slog.LevelInfo
+	case LogLevelDebug:
+		return slog.LevelDebug
+	default:
+		return SlogLevelTrace
+	}
+}
+
+// `slog.HandlerOptions.ReplaceAttr` function printing the custom levels as
+// `TRACE` and `CRITICAL` instead of `DEBUG-4` and `ERROR+4`
+func SlogReplaceAttr(groups []string, a slog.Attr) slog.Attr {
+	if a.Key != slog.LevelKey || len(groups) > 0 {
+		return a
+	}
+	if level, ok := a.Value.Any().(slog.Level); ok {
+		switch {
+		case level <= SlogLevelTrace:
+			return slog.String(slog.LevelKey, LogLevelTrace.String())
+		case level >= SlogLevelCritical:
+			return slog.String(slog.LevelKey, LogLevelCritical.String())
+		}
+	}
+	return a
+}
+
+type slogLogger struct {
+	handler slog.Handler
+}
+
+// Creates the Logger forwarding libdrop logs to the slog handler. The module
+// path prefix of libdrop messages is moved into the `module` attribute and
+// transfer UUIDs found in the message are added as `transfer_id`.
+func NewSlogLogger(handler slog.Handler) Logger {
+	return &slogLogger{handler: handler}
+}
+
+func (l *slogLogger) OnLog(level LogLevel, msg string) {
+	ctx := context.Background()
+	slogLevel := SlogLevel(level)
+	if !l.handler.Enabled(ctx, slogLevel) {
+		return
+	}
+
+	parsed := parseLogMessage(msg)
+	record := slog.NewRecord(time.Now(), slogLevel, parsed.text, 0)
+	if parsed.module != "" {
+		record.AddAttrs(slog.String("module", parsed.module))
+	}
+	switch len(parsed.transferIds) {
+	case 0:
+	case 1:
+		record.AddAttrs(slog.String("transfer_id", parsed.transferIds[0]))
+	default:
+		record.AddAttrs(slog.Any("transfer_id", parsed.transferIds))
+	}
+	_ = l.handler.Handle(ctx, record)
+}
+
+// The most verbose libdrop level the handler is enabled for
+func (l *slogLogger) Level() LogLevel {
+	ctx := context.Background()
+	for level := LogLevelTrace; level > LogLevelCritical; level-- {
+		if l.handler.Enabled(ctx, SlogLevel(level)) {
+			return level
+		}
+	}
+	return LogLevelCritical
+}
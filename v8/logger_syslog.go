@@ -0,0 +1,223 @@
+package norddrop
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Syslog facilities, see RFC 5424 section 6.2.1
+const (
+	SyslogFacilityUser   = 1
+	SyslogFacilityDaemon = 3
+	SyslogFacilityLocal0 = 16
+)
+
+// Maps the libdrop log level onto the syslog severity. Trace and debug both
+// map to debug (7).
+func SyslogSeverity(level LogLevel) int {
+	switch level {
+	case LogLevelCritical:
+		return 2
+	case LogLevelError:
+		return 3
+	case LogLevelWarning:
+		return 4
+	case LogLevelInfo:
+		return 6
+	default:
+		return 7
+	}
+}
+
+// Configuration of `SyslogLogger`
+type SyslogConfig struct {
+	// `unixgram`, `unix`, `udp` or `tcp`. `unixgram` if empty.
+	Network string
+	// Socket path or `host:port`. `/dev/log` if empty.
+	Address string
+	// Syslog facility, `SyslogFacilityUser` if zero
+	Facility int
+	// APP-NAME field, `norddrop` if empty
+	AppName string
+	// HOSTNAME field, `os.Hostname()` if empty
+	Hostname string
+	// Structured data ID carrying the module and transfer ID,
+	// `libdrop@32473` if empty
+	StructuredDataID string
+	// Maximum log level sent
+	Level LogLevel
+}
+
+// Bounds of the delay between reconnection attempts after the syslog
+// socket went away, doubled on every failed attempt
+const (
+	syslogMinBackoff = time.Second
+	syslogMaxBackoff = time.Minute
+)
+
+// Logger sending RFC 5424 messages to a syslog socket. Stream sockets use
+// octet counting framing (RFC 6587). When the socket goes away, e.g. on a
+// daemon restart, messages are dropped until reconnecting succeeds, which
+// is retried on later messages with a backoff.
+type SyslogLogger struct {
+	config SyslogConfig
+	procID string
+
+	mu      sync.Mutex
+	conn    net.Conn
+	closed  bool
+	backoff time.Duration
+	retryAt time.Time
+}
+
+func NewSyslogLogger(config SyslogConfig) (*SyslogLogger, error) {
+	if config.Network == "" {
+		config.Network = "unixgram"
+	}
+	if config.Address == "" {
+		config.Address = "/dev/log"
+	}
+	if config.Facility == 0 {
+		config.Facility = SyslogFacilityUser
+	}
+	if config.AppName == "" {
+		config.AppName = "norddrop"
+	}
+	if config.Hostname == "" {
+		config.Hostname, _ = os.Hostname()
+	}
+	if config.StructuredDataID == "" {
+		config.StructuredDataID = "libdrop@32473"
+	}
+
+	l := &SyslogLogger{
+		config: config,
+		procID: strconv.Itoa(os.Getpid()),
+	}
+	if err := l.connect(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *SyslogLogger) connect() error {
+	conn, err := net.Dial(l.config.Network, l.config.Address)
+	if err != nil {
+		return err
+	}
+	l.conn = conn
+	return nil
+}
+
+// Connects unless a previous attempt failed less than the backoff ago.
+// Needs `l.mu` held.
+func (l *SyslogLogger) reconnect(now time.Time) error {
+	if now.Before(l.retryAt) {
+		return fmt.Errorf("reconnecting is backed off until %s", l.retryAt)
+	}
+	if err := l.connect(); err != nil {
+		l.backoff = min(max(2*l.backoff, syslogMinBackoff), syslogMaxBackoff)
+		l.retryAt = now.Add(l.backoff)
+		return err
+	}
+	l.backoff = 0
+	l.retryAt = time.Time{}
+	return nil
+}
+
+func (l *SyslogLogger) OnLog(level LogLevel, msg string) {
+	if level > l.config.Level {
+		return
+	}
+	line := l.format(time.Now(), level, msg)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return
+	}
+	if l.conn == nil && l.reconnect(time.Now()) != nil {
+		return
+	}
+	if _, err := l.conn.Write(line); err != nil {
+		// The daemon may have been restarted, retry once on a new socket
+		l.conn.Close()
+		l.conn = nil
+		if l.reconnect(time.Now()) != nil {
+			return
+		}
+		_, _ = l.conn.Write(line)
+	}
+}
+
+func (l *SyslogLogger) Level() LogLevel {
+	return l.config.Level
+}
+
+func (l *SyslogLogger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.closed = true
+	if l.conn == nil {
+		return nil
+	}
+	err := l.conn.Close()
+	l.conn = nil
+	return err
+}
+
+func (l *SyslogLogger) format(ts time.Time, level LogLevel, msg string) []byte {
+	parsed := parseLogMessage(msg)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "<%d>1 %s %s %s %s - ",
+		l.config.Facility*8+SyslogSeverity(level),
+		ts.UTC().Format("2006-01-02T15:04:05.000000Z"),
+		syslogHeaderField(l.config.Hostname, 255),
+		syslogHeaderField(l.config.AppName, 48),
+		syslogHeaderField(l.procID, 128),
+	)
+
+	b.WriteString("[")
+	b.WriteString(l.config.StructuredDataID)
+	fmt.Fprintf(&b, ` level="%s"`, level)
+	if parsed.module != "" {
+		fmt.Fprintf(&b, ` module="%s"`, syslogParamValue(parsed.module))
+	}
+	for _, id := range parsed.transferIds {
+		fmt.Fprintf(&b, ` transfer_id="%s"`, id)
+	}
+	b.WriteString("] ")
+	b.WriteString(parsed.text)
+
+	if l.config.Network == "unixgram" || l.config.Network == "udp" {
+		return []byte(b.String())
+	}
+	return []byte(strconv.Itoa(b.Len()) + " " + b.String())
+}
+
+// Header fields are printable US-ASCII without spaces, `-` if empty
+func syslogHeaderField(value string, max int) string {
+	value = strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' {
+			return -1
+		}
+		return r
+	}, value)
+	if len(value) > max {
+		value = value[:max]
+	}
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+func syslogParamValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(value)
+}
@@ -0,0 +1,202 @@
+//go:build unix
+
+package norddrop
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const syslogTestMessage = "[drop_transfer::ws] Transfer 3fa85f64-5717-4562-b3fc-2c963f66afa6 started"
+
+var syslogTimestamp = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}\.\d{6}Z$`)
+
+// Checks the timestamp and returns the message with it replaced by `TS`
+func maskSyslogTimestamp(t *testing.T, msg string) string {
+	t.Helper()
+	fields := strings.SplitN(msg, " ", 3)
+	if len(fields) != 3 {
+		t.Fatalf("malformed message %q", msg)
+	}
+	if !syslogTimestamp.MatchString(fields[1]) {
+		t.Errorf("malformed timestamp %q", fields[1])
+	}
+	return fields[0] + " TS " + fields[2]
+}
+
+func syslogTestWant() string {
+	return fmt.Sprintf(`<30>1 TS myhost norddrop %d - [libdrop@32473 level="INFO" module="drop_transfer::ws" `+
+		`transfer_id="3fa85f64-5717-4562-b3fc-2c963f66afa6"] Transfer 3fa85f64-5717-4562-b3fc-2c963f66afa6 started`, os.Getpid())
+}
+
+func TestSyslogLoggerUnixgram(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "log")
+	server, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: sock, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	logger, err := NewSyslogLogger(SyslogConfig{
+		Address:  sock,
+		Facility: SyslogFacilityDaemon,
+		Hostname: "my host",
+		Level:    LogLevelInfo,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+
+	logger.OnLog(LogLevelDebug, "filtered out")
+	logger.OnLog(LogLevelInfo, syslogTestMessage)
+
+	buf := make([]byte, 4096)
+	server.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, err := server.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := maskSyslogTimestamp(t, string(buf[:n])), syslogTestWant(); got != want {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+}
+
+func TestSyslogLoggerStream(t *testing.T) {
+	for _, network := range []string{"unix", "tcp"} {
+		t.Run(network, func(t *testing.T) {
+			addr := filepath.Join(t.TempDir(), "log")
+			if network == "tcp" {
+				addr = "127.0.0.1:0"
+			}
+			ln, err := net.Listen(network, addr)
+			if err != nil {
+				t.Skipf("listening on %s: %v", network, err)
+			}
+			defer ln.Close()
+
+			logger, err := NewSyslogLogger(SyslogConfig{
+				Network:  network,
+				Address:  ln.Addr().String(),
+				Facility: SyslogFacilityDaemon,
+				Hostname: "myhost",
+				Level:    LogLevelInfo,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer logger.Close()
+
+			conn, err := ln.Accept()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+			logger.OnLog(LogLevelInfo, syslogTestMessage)
+			logger.OnLog(LogLevelInfo, syslogTestMessage)
+
+			rd := bufio.NewReader(conn)
+			for i := 0; i < 2; i++ {
+				prefix, err := rd.ReadString(' ')
+				if err != nil {
+					t.Fatal(err)
+				}
+				size, err := strconv.Atoi(strings.TrimSuffix(prefix, " "))
+				if err != nil {
+					t.Fatalf("no octet count in %q", prefix)
+				}
+				msg := make([]byte, size)
+				if _, err := io.ReadFull(rd, msg); err != nil {
+					t.Fatal(err)
+				}
+				if got, want := maskSyslogTimestamp(t, string(msg)), syslogTestWant(); got != want {
+					t.Errorf("got  %q\nwant %q", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestSyslogLoggerReconnect(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "log")
+	listen := func() *net.UnixConn {
+		server, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: sock, Net: "unixgram"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return server
+	}
+	server := listen()
+
+	logger, err := NewSyslogLogger(SyslogConfig{Address: sock, Level: LogLevelInfo})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+
+	// The daemon goes away, reconnecting fails and is backed off
+	server.Close()
+	os.Remove(sock)
+	logger.OnLog(LogLevelInfo, "lost")
+	logger.mu.Lock()
+	retryAt := logger.retryAt
+	logger.mu.Unlock()
+	if retryAt.IsZero() {
+		t.Fatal("failed reconnect not backed off")
+	}
+
+	server = listen()
+	defer server.Close()
+	logger.OnLog(LogLevelInfo, "backed off")
+
+	// The backoff elapsed
+	logger.mu.Lock()
+	logger.retryAt = time.Now()
+	logger.mu.Unlock()
+	logger.OnLog(LogLevelInfo, "recovered")
+
+	buf := make([]byte, 4096)
+	server.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, err := server.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg := string(buf[:n]); !strings.HasSuffix(msg, " recovered") {
+		t.Errorf("first message after the restart is %q", msg)
+	}
+}
+
+func TestSyslogParamValue(t *testing.T) {
+	if got, want := syslogParamValue(`a"b\c]d`), `a\"b\\c\]d`; got != want {
+		t.Errorf("syslogParamValue() = %q, want %q", got, want)
+	}
+}
+
+func TestSyslogHeaderField(t *testing.T) {
+	tests := []struct {
+		value string
+		max   int
+		want  string
+	}{
+		{"my host", 255, "myhost"},
+		{"", 255, "-"},
+		{"héllo\n", 255, "hllo"},
+		{"abcdef", 3, "abc"},
+	}
+	for _, tt := range tests {
+		if got := syslogHeaderField(tt.value, tt.max); got != tt.want {
+			t.Errorf("syslogHeaderField(%q, %d) = %q, want %q", tt.value, tt.max, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,301 @@
+package norddrop
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// A configuration value changed by `Manager.Reconfigure()`. Unset optional
+// fields are `nil`, set ones are dereferenced.
+type ConfigChange struct {
+	// `Config` field name or `addr` for the listen address
+	Field string
+	Old   any
+	New   any
+}
+
+// Emitted by `Manager` after the instance was restarted with a new
+// configuration. It is produced on the Go side and never by libdrop.
+type EventKindReconfigured struct {
+	Addr    string
+	Changes []ConfigChange
+}
+
+func (e EventKindReconfigured) Destroy() {}
+
+// How `Manager.Reconfigure()` treats files being transferred
+type ReconfigurePolicy uint
+
+const (
+	// Wait until no file is being transferred or the context is done. This
+	// is best effort: libdrop can't be kept from starting files, so a file
+	// starting between the wait and `Stop()` is paused like with
+	// `ReconfigurePause`, and lost with `InMemoryStorage`.
+	ReconfigureWaitIdle ReconfigurePolicy = iota
+	// Restart right away. Running files are paused by `Stop()` and resumed
+	// by libdrop after `Start()`, which requires persistent storage.
+	// Reconfiguring from or to `InMemoryStorage` is refused.
+	ReconfigurePause
+)
+
+type managerFileKey struct {
+	transferId string
+	fileId     string
+}
+
+// Owns a started instance and restarts it with a new configuration on
+// `Reconfigure()`. The instance, and with it the event callback, key store,
+// logger, FD resolver and every decorator bound to it, is kept across the
+// restart.
+type Manager struct {
+	next   EventCallback
+	drop   *NordDrop
+	policy ReconfigurePolicy
+
+	// Serializes reconfigurations
+	reconfigure sync.Mutex
+	addr        string
+	config      Config
+
+	mu       sync.Mutex
+	inflight map[managerFileKey]bool
+	idle     chan struct{}
+}
+
+// Creates and starts an instance like `New()` managed by the returned
+// `Manager`. The event handler given with `WithEventHandler()` also
+// receives `EventKindReconfigured`.
+func NewManager(policy ReconfigurePolicy, opts ...Option) (*Manager, error) {
+	o := options{addr: DefaultListenAddr, config: DefaultConfig()}
+	for _, opt := range opts {
+		if err := opt(&o); err != nil {
+			return nil, err
+		}
+	}
+	if o.noStart {
+		return nil, fmt.Errorf("Manager requires a started instance, WithoutStart() is not supported")
+	}
+
+	m := &Manager{
+		next:     o.events,
+		policy:   policy,
+		addr:     o.addr,
+		config:   o.config,
+		inflight: map[managerFileKey]bool{},
+	}
+	drop, err := New(append(opts, WithEventHandler(m))...)
+	if err != nil {
+		return nil, err
+	}
+	m.drop = drop
+	return m, nil
+}
+
+// Returns the managed instance
+func (m *Manager) NordDrop() *NordDrop {
+	return m.drop
+}
+
+// Returns the listen address and configuration the instance runs with
+func (m *Manager) Current() (string, Config) {
+	m.reconfigure.Lock()
+	defer m.reconfigure.Unlock()
+	return m.addr, m.config
+}
+
+// Lets `New()` bind decorators wrapped by the manager
+func (m *Manager) Bind(drop *NordDrop, config Config) {
+	bindToDrop(m.next, drop, config)
+}
+
+func (m *Manager) OnEvent(event Event) {
+	m.track(event.Kind)
+	if m.next != nil {
+		m.next.OnEvent(event)
+	}
+}
+
+func (m *Manager) track(kind EventKind) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	before := len(m.inflight)
+	switch k := kind.(type) {
+	case EventKindFileStarted:
+		m.inflight[managerFileKey{k.TransferId, k.FileId}] = true
+	case EventKindFileProgress:
+		m.inflight[managerFileKey{k.TransferId, k.FileId}] = true
+	case EventKindFileDownloaded:
+		delete(m.inflight, managerFileKey{k.TransferId, k.FileId})
+	case EventKindFileUploaded:
+		delete(m.inflight, managerFileKey{k.TransferId, k.FileId})
+	case EventKindFileFailed:
+		delete(m.inflight, managerFileKey{k.TransferId, k.FileId})
+	case EventKindFileRejected:
+		delete(m.inflight, managerFileKey{k.TransferId, k.FileId})
+	case EventKindFilePaused:
+		delete(m.inflight, managerFileKey{k.TransferId, k.FileId})
+	case EventKindFileThrottled:
+		delete(m.inflight, managerFileKey{k.TransferId, k.FileId})
+	case EventKindTransferFailed:
+		m.dropTransfer(k.TransferId)
+	case EventKindTransferFinalized:
+		m.dropTransfer(k.TransferId)
+	case EventKindTransferDeferred:
+		m.dropTransfer(k.TransferId)
+	}
+
+	switch after := len(m.inflight); {
+	case before == 0 && after > 0:
+		m.idle = make(chan struct{})
+	case before > 0 && after == 0:
+		close(m.idle)
+	}
+}
+
+// Needs `m.mu` held
+func (m *Manager) dropTransfer(transferId string) {
+	for key := range m.inflight {
+		if key.transferId == transferId {
+			delete(m.inflight, key)
+		}
+	}
+}
+
+func (m *Manager) resetInFlight() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.inflight) > 0 {
+		close(m.idle)
+	}
+	m.inflight = map[managerFileKey]bool{}
+}
+
+// Returns the number of files being transferred
+func (m *Manager) InFlight() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.inflight)
+}
+
+func (m *Manager) waitIdle(ctx context.Context) error {
+	for {
+		m.mu.Lock()
+		if len(m.inflight) == 0 {
+			m.mu.Unlock()
+			return nil
+		}
+		idle := m.idle
+		m.mu.Unlock()
+
+		select {
+		case <-idle:
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for %d files in flight: %w", m.InFlight(), ctx.Err())
+		}
+	}
+}
+
+// Restarts the instance on the current listen address with the new
+// configuration, see `ReconfigureAddr()`
+func (m *Manager) Reconfigure(ctx context.Context, config Config) error {
+	m.reconfigure.Lock()
+	addr := m.addr
+	m.reconfigure.Unlock()
+	return m.ReconfigureAddr(ctx, addr, config)
+}
+
+// Restarts the instance with the new listen address and configuration.
+// Nothing happens when neither changed. The new values are validated first
+// and, depending on the policy, in-flight files are waited for, see
+// `ReconfigureWaitIdle` for its limits. When the instance fails to start
+// with the new values it is started with the previous ones again and the
+// error is returned.
+//
+// On success `EventKindReconfigured` listing the changes is emitted.
+func (m *Manager) ReconfigureAddr(ctx context.Context, addr string, config Config) error {
+	event, err := m.reconfigureAddr(ctx, addr, config)
+	// Emitted after unlocking so the handler can call `Current()`
+	if event != nil && m.next != nil {
+		m.next.OnEvent(Event{
+			Timestamp: time.Now().UnixMilli(),
+			Kind:      *event,
+		})
+	}
+	return err
+}
+
+// Returns the event to emit on success, `nil` when nothing changed
+func (m *Manager) reconfigureAddr(ctx context.Context, addr string, config Config) (*EventKindReconfigured, error) {
+	m.reconfigure.Lock()
+	defer m.reconfigure.Unlock()
+
+	changes := diffConfig(m.addr, m.config, addr, config)
+	if len(changes) == 0 {
+		return nil, nil
+	}
+	if err := ValidateStart(addr, config); err != nil {
+		return nil, err
+	}
+	if m.policy == ReconfigurePause {
+		for _, path := range []string{m.config.StoragePath, config.StoragePath} {
+			if path == InMemoryStorage {
+				return nil, &FieldError{Field: "StoragePath", Value: path,
+					Err: fmt.Errorf("ReconfigurePause requires persistent storage, transfers in flight would be lost")}
+			}
+		}
+	}
+	if m.policy == ReconfigureWaitIdle {
+		if err := m.waitIdle(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := m.drop.Stop(); err != nil {
+		return nil, fmt.Errorf("stopping: %w", err)
+	}
+	// libdrop doesn't report every file cut off by `Stop()`, resumed files
+	// are tracked again once they make progress
+	m.resetInFlight()
+	if err := m.drop.Start(addr, config); err != nil {
+		if rerr := m.drop.Start(m.addr, m.config); rerr != nil {
+			return nil, errors.Join(fmt.Errorf("starting with the new configuration: %w", err),
+				fmt.Errorf("restoring the previous configuration: %w", rerr))
+		}
+		return nil, fmt.Errorf("starting with the new configuration, the previous one is restored: %w", err)
+	}
+	m.addr, m.config = addr, config
+	// Decorators such as `Diagnostics` report the configuration
+	bindToDrop(m.next, m.drop, config)
+	return &EventKindReconfigured{Addr: addr, Changes: changes}, nil
+}
+
+func diffConfig(oldAddr string, old Config, newAddr string, new Config) []ConfigChange {
+	var changes []ConfigChange
+	if oldAddr != newAddr {
+		changes = append(changes, ConfigChange{Field: "addr", Old: oldAddr, New: newAddr})
+	}
+
+	oldValue, newValue := reflect.ValueOf(old), reflect.ValueOf(new)
+	for i := 0; i < oldValue.NumField(); i++ {
+		o, n := configFieldValue(oldValue.Field(i)), configFieldValue(newValue.Field(i))
+		if o != n {
+			changes = append(changes, ConfigChange{Field: oldValue.Type().Field(i).Name, Old: o, New: n})
+		}
+	}
+	return changes
+}
+
+func configFieldValue(v reflect.Value) any {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	return v.Interface()
+}
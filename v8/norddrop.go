@@ -1,3 +1,35 @@
+// Generated uniffi bindings, patched by hand. The patches below are
+// lost on regeneration and must be reapplied, everything else lives in
+// non-generated files:
+//
+// Call context on errors, see `libdrop_error.go`:
+//   - `LibdropError` has a `call *LibdropCall` field, appended by `Error()`
+//   - `FfiConverterTypeLibdropError.Read()` builds `&LibdropError{err: ...}`
+//     with the field keyed
+//   - `NewNordDrop()` and every `NordDrop` method pass `_uniffiErr` through
+//     `withLibdropCall()` with the method name and its arguments
+//
+// Panic recovery, see `rust_panic.go`:
+//   - `checkCallStatus()` and `checkCallStatusUnknown()` panic with
+//     `*RustPanicError` instead of a plain error
+//   - `rustCallWithErrorOn()` is added after `rustCallWithError()`
+//   - `NordDrop` has a `panics panicGuard` field, so the
+//     `FfiConverterNordDrop.Lift()` literal keys `ffiObject:`
+//   - every `NordDrop` method calls `rustCallWithErrorOn(_self, ...)`
+//     instead of `rustCallWithError(...)`
+//
+// Unknown variants, see `unknown_variant.go`:
+//   - `FfiConverterTypeEventKind.Read()` returns `EventKindUnknown` for
+//     unknown tags and `Write()` writes it back
+//   - `FfiConverterTypeLibdropError.Read()` returns
+//     `*LibdropErrorUnrecognized` for unknown codes and `Write()` writes it
+//     back
+//   - the other enum `Read()` functions panic with `*UnknownVariantError`
+//     instead of a string
+//   - `TransfersSince()` lifts its result through `liftKnownVariants()`
+//   - the docs of `IncomingPathStateKind`, `OutgoingPathStateKind`,
+//     `OutgoingFileSource`, `TransferKind` and `TransferStateKind` note the
+//     unknown variant behaviour
 
 package norddrop
 
@@ -149,6 +181,24 @@ func rustCallWithError[U any](converter BufLifter[error], callback func(*C.RustC
 	return returnValue, err
 }
 
+// Like `rustCallWithError()`, but when panic recovery is enabled on the
+// instance a panic during the call poisons the instance and is returned as
+// `*RustPanicError`, and calls on a poisoned instance fail right away.
+func rustCallWithErrorOn[U any](drop *NordDrop, converter BufLifter[error], callback func(*C.RustCallStatus) U) (result U, err error) {
+	if !drop.panics.enabled.Load() {
+		return rustCallWithError(converter, callback)
+	}
+	if err := drop.Poisoned(); err != nil {
+		return result, err
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = drop.panics.poison(r)
+		}
+	}()
+	return rustCallWithError(converter, callback)
+}
+
 func checkCallStatus(converter BufLifter[error], status C.RustCallStatus) error {
 	switch status.code {
 	case 0:
@@ -160,9 +210,9 @@ func checkCallStatus(converter BufLifter[error], status C.RustCallStatus) error
 		// with the message.  but if that code panics, then it just sends back
 		// an empty buffer.
 		if status.errorBuf.len > 0 {
-			panic(fmt.Errorf("%s", FfiConverterStringINSTANCE.Lift(status.errorBuf)))
+			panic(&RustPanicError{Message: FfiConverterStringINSTANCE.Lift(status.errorBuf)})
 		} else {
-			panic(fmt.Errorf("Rust panicked while handling Rust panic"))
+			panic(&RustPanicError{Message: "Rust panicked while handling Rust panic"})
 		}
 	default:
 		return fmt.Errorf("unknown status code: %d", status.code)
@@ -180,9 +230,9 @@ func checkCallStatusUnknown(status C.RustCallStatus) error {
 		// with the message.  but if that code panics, then it just sends back
 		// an empty buffer.
 		if status.errorBuf.len > 0 {
-			panic(fmt.Errorf("%s", FfiConverterStringINSTANCE.Lift(status.errorBuf)))
+			panic(&RustPanicError{Message: FfiConverterStringINSTANCE.Lift(status.errorBuf)})
 		} else {
-			panic(fmt.Errorf("Rust panicked while handling Rust panic"))
+			panic(&RustPanicError{Message: "Rust panicked while handling Rust panic"})
 		}
 	default:
 		return fmt.Errorf("unknown status code: %d", status.code)
@@ -831,6 +881,7 @@ func (ffiObject *FfiObject)freeRustArcPtr() {
 }
 type NordDrop struct {
 	ffiObject FfiObject
+	panics panicGuard
 }
 // Create a new instance of norddrop. This is a required step to work
 // with API further
@@ -843,6 +894,7 @@ func NewNordDrop(eventCb EventCallback, keyStore KeyStore, logger Logger) (*Nord
 	_uniffiRV, _uniffiErr := rustCallWithError(FfiConverterTypeLibdropError{},func(_uniffiStatus *C.RustCallStatus) unsafe.Pointer {
 		return C.uniffi_norddrop_fn_constructor_norddrop_new(FfiConverterCallbackInterfaceEventCallbackINSTANCE.Lower(eventCb), FfiConverterCallbackInterfaceKeyStoreINSTANCE.Lower(keyStore), FfiConverterCallbackInterfaceLoggerINSTANCE.Lower(logger), _uniffiStatus)
 	})
+	_uniffiErr = withLibdropCall(_uniffiErr, "NewNordDrop")
 		if _uniffiErr != nil {
 			var _uniffiDefaultValue *NordDrop
 			return _uniffiDefaultValue, _uniffiErr
@@ -863,11 +915,12 @@ func NewNordDrop(eventCb EventCallback, keyStore KeyStore, logger Logger) (*Nord
 func (_self *NordDrop)DownloadFile(transferId string, fileId string, destination string) error {
 	_pointer := _self.ffiObject.incrementPointer("*NordDrop")
 	defer _self.ffiObject.decrementPointer()
-	_, _uniffiErr := rustCallWithError(FfiConverterTypeLibdropError{},func(_uniffiStatus *C.RustCallStatus) bool {
+	_, _uniffiErr := rustCallWithErrorOn(_self, FfiConverterTypeLibdropError{},func(_uniffiStatus *C.RustCallStatus) bool {
 		C.uniffi_norddrop_fn_method_norddrop_download_file(
 		_pointer,FfiConverterStringINSTANCE.Lower(transferId), FfiConverterStringINSTANCE.Lower(fileId), FfiConverterStringINSTANCE.Lower(destination), _uniffiStatus)
 		return false
 	})
+	_uniffiErr = withLibdropCall(_uniffiErr, "DownloadFile", "transferId", transferId, "fileId", fileId, "destination", destination)
 		return _uniffiErr
 }
 
@@ -879,11 +932,12 @@ func (_self *NordDrop)DownloadFile(transferId string, fileId string, destination
 func (_self *NordDrop)FinalizeTransfer(transferId string) error {
 	_pointer := _self.ffiObject.incrementPointer("*NordDrop")
 	defer _self.ffiObject.decrementPointer()
-	_, _uniffiErr := rustCallWithError(FfiConverterTypeLibdropError{},func(_uniffiStatus *C.RustCallStatus) bool {
+	_, _uniffiErr := rustCallWithErrorOn(_self, FfiConverterTypeLibdropError{},func(_uniffiStatus *C.RustCallStatus) bool {
 		C.uniffi_norddrop_fn_method_norddrop_finalize_transfer(
 		_pointer,FfiConverterStringINSTANCE.Lower(transferId), _uniffiStatus)
 		return false
 	})
+	_uniffiErr = withLibdropCall(_uniffiErr, "FinalizeTransfer", "transferId", transferId)
 		return _uniffiErr
 }
 
@@ -894,11 +948,12 @@ func (_self *NordDrop)FinalizeTransfer(transferId string) error {
 func (_self *NordDrop)NetworkRefresh() error {
 	_pointer := _self.ffiObject.incrementPointer("*NordDrop")
 	defer _self.ffiObject.decrementPointer()
-	_, _uniffiErr := rustCallWithError(FfiConverterTypeLibdropError{},func(_uniffiStatus *C.RustCallStatus) bool {
+	_, _uniffiErr := rustCallWithErrorOn(_self, FfiConverterTypeLibdropError{},func(_uniffiStatus *C.RustCallStatus) bool {
 		C.uniffi_norddrop_fn_method_norddrop_network_refresh(
 		_pointer, _uniffiStatus)
 		return false
 	})
+	_uniffiErr = withLibdropCall(_uniffiErr, "NetworkRefresh")
 		return _uniffiErr
 }
 
@@ -914,10 +969,11 @@ func (_self *NordDrop)NetworkRefresh() error {
 func (_self *NordDrop)NewTransfer(peer string, descriptors []TransferDescriptor) (string, error) {
 	_pointer := _self.ffiObject.incrementPointer("*NordDrop")
 	defer _self.ffiObject.decrementPointer()
-	_uniffiRV, _uniffiErr := rustCallWithError(FfiConverterTypeLibdropError{},func(_uniffiStatus *C.RustCallStatus) RustBufferI {
+	_uniffiRV, _uniffiErr := rustCallWithErrorOn(_self, FfiConverterTypeLibdropError{},func(_uniffiStatus *C.RustCallStatus) RustBufferI {
 		return C.uniffi_norddrop_fn_method_norddrop_new_transfer(
 		_pointer,FfiConverterStringINSTANCE.Lower(peer), FfiConverterSequenceTypeTransferDescriptorINSTANCE.Lower(descriptors), _uniffiStatus)
 	})
+	_uniffiErr = withLibdropCall(_uniffiErr, "NewTransfer", "peer", peer, "descriptors", len(descriptors))
 		if _uniffiErr != nil {
 			var _uniffiDefaultValue string
 			return _uniffiDefaultValue, _uniffiErr
@@ -934,11 +990,12 @@ func (_self *NordDrop)NewTransfer(peer string, descriptors []TransferDescriptor)
 func (_self *NordDrop)PurgeTransfers(transferIds []string) error {
 	_pointer := _self.ffiObject.incrementPointer("*NordDrop")
 	defer _self.ffiObject.decrementPointer()
-	_, _uniffiErr := rustCallWithError(FfiConverterTypeLibdropError{},func(_uniffiStatus *C.RustCallStatus) bool {
+	_, _uniffiErr := rustCallWithErrorOn(_self, FfiConverterTypeLibdropError{},func(_uniffiStatus *C.RustCallStatus) bool {
 		C.uniffi_norddrop_fn_method_norddrop_purge_transfers(
 		_pointer,FfiConverterSequenceStringINSTANCE.Lower(transferIds), _uniffiStatus)
 		return false
 	})
+	_uniffiErr = withLibdropCall(_uniffiErr, "PurgeTransfers", "transferIds", transferIds)
 		return _uniffiErr
 }
 
@@ -950,11 +1007,12 @@ func (_self *NordDrop)PurgeTransfers(transferIds []string) error {
 func (_self *NordDrop)PurgeTransfersUntil(until int64) error {
 	_pointer := _self.ffiObject.incrementPointer("*NordDrop")
 	defer _self.ffiObject.decrementPointer()
-	_, _uniffiErr := rustCallWithError(FfiConverterTypeLibdropError{},func(_uniffiStatus *C.RustCallStatus) bool {
+	_, _uniffiErr := rustCallWithErrorOn(_self, FfiConverterTypeLibdropError{},func(_uniffiStatus *C.RustCallStatus) bool {
 		C.uniffi_norddrop_fn_method_norddrop_purge_transfers_until(
 		_pointer,FfiConverterInt64INSTANCE.Lower(until), _uniffiStatus)
 		return false
 	})
+	_uniffiErr = withLibdropCall(_uniffiErr, "PurgeTransfersUntil", "until", until)
 		return _uniffiErr
 }
 
@@ -967,11 +1025,12 @@ func (_self *NordDrop)PurgeTransfersUntil(until int64) error {
 func (_self *NordDrop)RejectFile(transferId string, fileId string) error {
 	_pointer := _self.ffiObject.incrementPointer("*NordDrop")
 	defer _self.ffiObject.decrementPointer()
-	_, _uniffiErr := rustCallWithError(FfiConverterTypeLibdropError{},func(_uniffiStatus *C.RustCallStatus) bool {
+	_, _uniffiErr := rustCallWithErrorOn(_self, FfiConverterTypeLibdropError{},func(_uniffiStatus *C.RustCallStatus) bool {
 		C.uniffi_norddrop_fn_method_norddrop_reject_file(
 		_pointer,FfiConverterStringINSTANCE.Lower(transferId), FfiConverterStringINSTANCE.Lower(fileId), _uniffiStatus)
 		return false
 	})
+	_uniffiErr = withLibdropCall(_uniffiErr, "RejectFile", "transferId", transferId, "fileId", fileId)
 		return _uniffiErr
 }
 
@@ -985,11 +1044,12 @@ func (_self *NordDrop)RejectFile(transferId string, fileId string) error {
 func (_self *NordDrop)RemoveFile(transferId string, fileId string) error {
 	_pointer := _self.ffiObject.incrementPointer("*NordDrop")
 	defer _self.ffiObject.decrementPointer()
-	_, _uniffiErr := rustCallWithError(FfiConverterTypeLibdropError{},func(_uniffiStatus *C.RustCallStatus) bool {
+	_, _uniffiErr := rustCallWithErrorOn(_self, FfiConverterTypeLibdropError{},func(_uniffiStatus *C.RustCallStatus) bool {
 		C.uniffi_norddrop_fn_method_norddrop_remove_file(
 		_pointer,FfiConverterStringINSTANCE.Lower(transferId), FfiConverterStringINSTANCE.Lower(fileId), _uniffiStatus)
 		return false
 	})
+	_uniffiErr = withLibdropCall(_uniffiErr, "RemoveFile", "transferId", transferId, "fileId", fileId)
 		return _uniffiErr
 }
 
@@ -1007,11 +1067,12 @@ func (_self *NordDrop)RemoveFile(transferId string, fileId string) error {
 func (_self *NordDrop)SetFdResolver(resolver FdResolver) error {
 	_pointer := _self.ffiObject.incrementPointer("*NordDrop")
 	defer _self.ffiObject.decrementPointer()
-	_, _uniffiErr := rustCallWithError(FfiConverterTypeLibdropError{},func(_uniffiStatus *C.RustCallStatus) bool {
+	_, _uniffiErr := rustCallWithErrorOn(_self, FfiConverterTypeLibdropError{},func(_uniffiStatus *C.RustCallStatus) bool {
 		C.uniffi_norddrop_fn_method_norddrop_set_fd_resolver(
 		_pointer,FfiConverterCallbackInterfaceFdResolverINSTANCE.Lower(resolver), _uniffiStatus)
 		return false
 	})
+	_uniffiErr = withLibdropCall(_uniffiErr, "SetFdResolver")
 		return _uniffiErr
 }
 
@@ -1045,11 +1106,12 @@ func (_self *NordDrop)SetFdResolver(resolver FdResolver) error {
 func (_self *NordDrop)Start(addr string, config Config) error {
 	_pointer := _self.ffiObject.incrementPointer("*NordDrop")
 	defer _self.ffiObject.decrementPointer()
-	_, _uniffiErr := rustCallWithError(FfiConverterTypeLibdropError{},func(_uniffiStatus *C.RustCallStatus) bool {
+	_, _uniffiErr := rustCallWithErrorOn(_self, FfiConverterTypeLibdropError{},func(_uniffiStatus *C.RustCallStatus) bool {
 		C.uniffi_norddrop_fn_method_norddrop_start(
 		_pointer,FfiConverterStringINSTANCE.Lower(addr), FfiConverterTypeConfigINSTANCE.Lower(config), _uniffiStatus)
 		return false
 	})
+	_uniffiErr = withLibdropCall(_uniffiErr, "Start", "addr", addr)
 		return _uniffiErr
 }
 
@@ -1058,11 +1120,12 @@ func (_self *NordDrop)Start(addr string, config Config) error {
 func (_self *NordDrop)Stop() error {
 	_pointer := _self.ffiObject.incrementPointer("*NordDrop")
 	defer _self.ffiObject.decrementPointer()
-	_, _uniffiErr := rustCallWithError(FfiConverterTypeLibdropError{},func(_uniffiStatus *C.RustCallStatus) bool {
+	_, _uniffiErr := rustCallWithErrorOn(_self, FfiConverterTypeLibdropError{},func(_uniffiStatus *C.RustCallStatus) bool {
 		C.uniffi_norddrop_fn_method_norddrop_stop(
 		_pointer, _uniffiStatus)
 		return false
 	})
+	_uniffiErr = withLibdropCall(_uniffiErr, "Stop")
 		return _uniffiErr
 }
 
@@ -1074,15 +1137,18 @@ func (_self *NordDrop)Stop() error {
 func (_self *NordDrop)TransfersSince(since int64) ([]TransferInfo, error) {
 	_pointer := _self.ffiObject.incrementPointer("*NordDrop")
 	defer _self.ffiObject.decrementPointer()
-	_uniffiRV, _uniffiErr := rustCallWithError(FfiConverterTypeLibdropError{},func(_uniffiStatus *C.RustCallStatus) RustBufferI {
+	_uniffiRV, _uniffiErr := rustCallWithErrorOn(_self, FfiConverterTypeLibdropError{},func(_uniffiStatus *C.RustCallStatus) RustBufferI {
 		return C.uniffi_norddrop_fn_method_norddrop_transfers_since(
 		_pointer,FfiConverterInt64INSTANCE.Lower(since), _uniffiStatus)
 	})
+	_uniffiErr = withLibdropCall(_uniffiErr, "TransfersSince", "since", since)
 		if _uniffiErr != nil {
 			var _uniffiDefaultValue []TransferInfo
 			return _uniffiDefaultValue, _uniffiErr
 		} else {
-			return FfiConverterSequenceTypeTransferInfoINSTANCE.Lift(_uniffiRV), _uniffiErr
+			return liftKnownVariants(func() []TransferInfo {
+				return FfiConverterSequenceTypeTransferInfoINSTANCE.Lift(_uniffiRV)
+			})
 		}
 }
 
@@ -1099,7 +1165,7 @@ var FfiConverterNordDropINSTANCE = FfiConverterNordDrop{}
 
 func (c FfiConverterNordDrop) Lift(pointer unsafe.Pointer) *NordDrop {
 	result := &NordDrop {
-		newFfiObject(
+		ffiObject: newFfiObject(
 			pointer,
 			func(pointer unsafe.Pointer, status *C.RustCallStatus) {
 				C.uniffi_norddrop_fn_free_norddrop(pointer, status)
@@ -2127,7 +2193,7 @@ func (FfiConverterTypeEventKind) Read(reader io.Reader) EventKind {
 				FfiConverterTypeStatusCodeINSTANCE.Read(reader),
 			};
 		default:
-			panic(fmt.Sprintf("invalid enum value %v in FfiConverterTypeEventKind.Read()", id));
+			return EventKindUnknown{Tag: id, Data: readRemaining(reader)};
 	}
 }
 
@@ -2230,6 +2296,11 @@ func (FfiConverterTypeEventKind) Write(writer io.Writer, value EventKind) {
 		case EventKindRuntimeError:
 			writeInt32(writer, 21)
 			FfiConverterTypeStatusCodeINSTANCE.Write(writer, variant_value.Status)
+		case EventKindUnknown:
+			writeInt32(writer, variant_value.Tag)
+			if _, err := writer.Write(variant_value.Data); err != nil {
+				panic(err)
+			}
 		default:
 			_ = variant_value
 			panic(fmt.Sprintf("invalid enum value `%v` in FfiConverterTypeEventKind.Write", value))
@@ -2248,6 +2319,10 @@ func (_ FfiDestroyerTypeEventKind) Destroy(value EventKind) {
 // Description of incoming file states.
 // Some states are considered **terminal**. Terminal states appear
 // once and it is the final state. Other states might appear multiple times.
+//
+// Variants added by a newer libdrop can't be decoded: `TransfersSince()`
+// returns `*UnknownVariantError` for them, anywhere else decoding panics
+// with it.
 type IncomingPathStateKind interface {
 	Destroy()
 }
@@ -2353,7 +2428,7 @@ func (FfiConverterTypeIncomingPathStateKind) Read(reader io.Reader) IncomingPath
 				FfiConverterUint64INSTANCE.Read(reader),
 			};
 		default:
-			panic(fmt.Sprintf("invalid enum value %v in FfiConverterTypeIncomingPathStateKind.Read()", id));
+			panic(&UnknownVariantError{Type: "IncomingPathStateKind", Tag: id});
 	}
 }
 
@@ -2395,9 +2470,13 @@ func (_ FfiDestroyerTypeIncomingPathStateKind) Destroy(value IncomingPathStateKi
 // The commmon error type thrown from functions
 type LibdropError struct {
 	err error
+	call *LibdropCall
 }
 
 func (err LibdropError) Error() string {
+	if err.call != nil {
+		return fmt.Sprintf("LibdropError: %s (%s)", err.err.Error(), err.call)
+	}
 	return fmt.Sprintf("LibdropError: %s", err.err.Error())
 }
 
@@ -2637,27 +2716,27 @@ func (c FfiConverterTypeLibdropError) Read(reader io.Reader) error {
 	message := FfiConverterStringINSTANCE.Read(reader)
 	switch errorID {
 	case 1:
-		return &LibdropError{&LibdropErrorUnknown{message}}
+		return &LibdropError{err: &LibdropErrorUnknown{message}}
 	case 2:
-		return &LibdropError{&LibdropErrorInvalidString{message}}
+		return &LibdropError{err: &LibdropErrorInvalidString{message}}
 	case 3:
-		return &LibdropError{&LibdropErrorBadInput{message}}
+		return &LibdropError{err: &LibdropErrorBadInput{message}}
 	case 4:
-		return &LibdropError{&LibdropErrorTransferCreate{message}}
+		return &LibdropError{err: &LibdropErrorTransferCreate{message}}
 	case 5:
-		return &LibdropError{&LibdropErrorNotStarted{message}}
+		return &LibdropError{err: &LibdropErrorNotStarted{message}}
 	case 6:
-		return &LibdropError{&LibdropErrorAddrInUse{message}}
+		return &LibdropError{err: &LibdropErrorAddrInUse{message}}
 	case 7:
-		return &LibdropError{&LibdropErrorInstanceStart{message}}
+		return &LibdropError{err: &LibdropErrorInstanceStart{message}}
 	case 8:
-		return &LibdropError{&LibdropErrorInstanceStop{message}}
+		return &LibdropError{err: &LibdropErrorInstanceStop{message}}
 	case 9:
-		return &LibdropError{&LibdropErrorInvalidPrivkey{message}}
+		return &LibdropError{err: &LibdropErrorInvalidPrivkey{message}}
 	case 10:
-		return &LibdropError{&LibdropErrorDbError{message}}
+		return &LibdropError{err: &LibdropErrorDbError{message}}
 	default:
-		panic(fmt.Sprintf("Unknown error code %d in FfiConverterTypeLibdropError.Read()", errorID))
+		return &LibdropError{err: &LibdropErrorUnrecognized{code: errorID, message: message}}
 	}
 
 	
@@ -2685,6 +2764,8 @@ func (c FfiConverterTypeLibdropError) Write(writer io.Writer, value *LibdropErro
 			writeInt32(writer, 9)
 		case *LibdropErrorDbError:
 			writeInt32(writer, 10)
+		case *LibdropErrorUnrecognized:
+			writeInt32(writer, int32(variantValue.code))
 		default:
 			_ = variantValue
 			panic(fmt.Sprintf("invalid error value `%v` in FfiConverterTypeLibdropError.Write", value))
@@ -2734,6 +2815,10 @@ func (_ FfiDestroyerTypeLogLevel) Destroy(value LogLevel) {
 
 
 // The outgoing file data source
+//
+// Variants added by a newer libdrop can't be decoded: `TransfersSince()`
+// returns `*UnknownVariantError` for them, anywhere else decoding panics
+// with it.
 type OutgoingFileSource interface {
 	Destroy()
 }
@@ -2780,7 +2865,7 @@ func (FfiConverterTypeOutgoingFileSource) Read(reader io.Reader) OutgoingFileSou
 				FfiConverterStringINSTANCE.Read(reader),
 			};
 		default:
-			panic(fmt.Sprintf("invalid enum value %v in FfiConverterTypeOutgoingFileSource.Read()", id));
+			panic(&UnknownVariantError{Type: "OutgoingFileSource", Tag: id});
 	}
 }
 
@@ -2810,6 +2895,10 @@ func (_ FfiDestroyerTypeOutgoingFileSource) Destroy(value OutgoingFileSource) {
 // Description of outgoing file states.
 // Some states are considered **terminal**. Terminal states appear
 // once and it is the final state. Other states might appear multiple times.
+//
+// Variants added by a newer libdrop can't be decoded: `TransfersSince()`
+// returns `*UnknownVariantError` for them, anywhere else decoding panics
+// with it.
 type OutgoingPathStateKind interface {
 	Destroy()
 }
@@ -2899,7 +2988,7 @@ func (FfiConverterTypeOutgoingPathStateKind) Read(reader io.Reader) OutgoingPath
 				FfiConverterUint64INSTANCE.Read(reader),
 			};
 		default:
-			panic(fmt.Sprintf("invalid enum value %v in FfiConverterTypeOutgoingPathStateKind.Read()", id));
+			panic(&UnknownVariantError{Type: "OutgoingPathStateKind", Tag: id});
 	}
 }
 
@@ -3083,7 +3172,7 @@ func (FfiConverterTypeTransferDescriptor) Read(reader io.Reader) TransferDescrip
 				FfiConverterOptionalInt32INSTANCE.Read(reader),
 			};
 		default:
-			panic(fmt.Sprintf("invalid enum value %v in FfiConverterTypeTransferDescriptor.Read()", id));
+			panic(&UnknownVariantError{Type: "TransferDescriptor", Tag: id});
 	}
 }
 
@@ -3113,6 +3202,10 @@ func (_ FfiDestroyerTypeTransferDescriptor) Destroy(value TransferDescriptor) {
 
 
 // A type of the transfer
+//
+// Variants added by a newer libdrop can't be decoded: `TransfersSince()`
+// returns `*UnknownVariantError` for them, anywhere else decoding panics
+// with it.
 type TransferKind interface {
 	Destroy()
 }
@@ -3156,7 +3249,7 @@ func (FfiConverterTypeTransferKind) Read(reader io.Reader) TransferKind {
 				FfiConverterSequenceTypeOutgoingPathINSTANCE.Read(reader),
 			};
 		default:
-			panic(fmt.Sprintf("invalid enum value %v in FfiConverterTypeTransferKind.Read()", id));
+			panic(&UnknownVariantError{Type: "TransferKind", Tag: id});
 	}
 }
 
@@ -3184,6 +3277,10 @@ func (_ FfiDestroyerTypeTransferKind) Destroy(value TransferKind) {
 
 
 // Description of the transfer state
+//
+// Variants added by a newer libdrop can't be decoded: `TransfersSince()`
+// returns `*UnknownVariantError` for them, anywhere else decoding panics
+// with it.
 type TransferStateKind interface {
 	Destroy()
 }
@@ -3228,7 +3325,7 @@ func (FfiConverterTypeTransferStateKind) Read(reader io.Reader) TransferStateKin
 				FfiConverterTypeStatusCodeINSTANCE.Read(reader),
 			};
 		default:
-			panic(fmt.Sprintf("invalid enum value %v in FfiConverterTypeTransferStateKind.Read()", id));
+			panic(&UnknownVariantError{Type: "TransferStateKind", Tag: id});
 	}
 }
 
@@ -0,0 +1,261 @@
+package norddrop
+
+import (
+	"crypto/rand"
+	"fmt"
+	"time"
+)
+
+// Listen address used by `New()` unless `WithListenAddr()` is given
+const DefaultListenAddr = "0.0.0.0"
+
+type options struct {
+	addr       string
+	config     Config
+	events     EventCallback
+	keyStore   KeyStore
+	logger     Logger
+	fdResolver FdResolver
+	noStart    bool
+	recover    bool
+}
+
+// Configures the instance created by `New()`
+type Option func(*options) error
+
+// Address to listen on, `DefaultListenAddr` if not given
+func WithListenAddr(addr string) Option {
+	return func(o *options) error {
+		o.addr = addr
+		return nil
+	}
+}
+
+// Replaces the whole configuration, `DefaultConfig()` if not given. Options
+// following it modify the replaced configuration.
+func WithConfig(config Config) Option {
+	return func(o *options) error {
+		o.config = config
+		return nil
+	}
+}
+
+// Storage path of the persistence engine, `InMemoryStorage` if not given
+func WithStorage(path string) Option {
+	return func(o *options) error {
+		o.config.StoragePath = path
+		return nil
+	}
+}
+
+// Number of burst connection retries, see `Config.ConnectionRetries`
+func WithRetries(retries uint32) Option {
+	return func(o *options) error {
+		o.config.ConnectionRetries = &retries
+		return nil
+	}
+}
+
+// Makes libdrop retry connections on its own every `interval`, see
+// `Config.AutoRetryIntervalMs`
+func WithAutoRetry(interval time.Duration) Option {
+	return func(o *options) error {
+		ms := interval.Milliseconds()
+		if ms <= 0 || ms > int64(^uint32(0)) {
+			return fmt.Errorf("auto retry interval %s is out of range", interval)
+		}
+		v := uint32(ms)
+		o.config.AutoRetryIntervalMs = &v
+		return nil
+	}
+}
+
+// Emits checksum events for files of at least `threshold` bytes every
+// `granularity` bytes
+func WithChecksumEvents(threshold uint64, granularity uint64) Option {
+	return func(o *options) error {
+		o.config.ChecksumEventsSizeThreshold = &threshold
+		o.config.ChecksumEventsGranularity = &granularity
+		return nil
+	}
+}
+
+// Limits of the directory trees sent, see `Config.DirDepthLimit` and
+// `Config.TransferFileLimit`
+func WithLimits(dirDepth uint64, transferFiles uint64) Option {
+	return func(o *options) error {
+		o.config.DirDepthLimit = dirDepth
+		o.config.TransferFileLimit = transferFiles
+		return nil
+	}
+}
+
+// Logger receiving libdrop logs, discarded if not given
+func WithLogger(logger Logger) Option {
+	return func(o *options) error {
+		o.logger = logger
+		return nil
+	}
+}
+
+// Callback receiving libdrop events, discarded if not given
+func WithEventHandler(events EventCallback) Option {
+	return func(o *options) error {
+		o.events = events
+		return nil
+	}
+}
+
+// Resolver of `TransferDescriptorFd` content URIs, installed before the
+// instance is started
+func WithFdResolver(resolver FdResolver) Option {
+	return func(o *options) error {
+		o.fdResolver = resolver
+		return nil
+	}
+}
+
+// Key store of the instance. Without it a random private key is generated
+// and no peer is trusted, which is only useful for tests.
+func WithKeyStore(keyStore KeyStore) Option {
+	return func(o *options) error {
+		o.keyStore = keyStore
+		return nil
+	}
+}
+
+// Makes `New()` return the instance without starting it
+func WithoutStart() Option {
+	return func(o *options) error {
+		o.noStart = true
+		return nil
+	}
+}
+
+// Makes the instance return libdrop panics as errors and poison itself
+// instead of panicking, see `NordDrop.RecoverPanics()`. A panic while
+// creating the instance is returned by `New()`.
+func WithPanicRecovery() Option {
+	return func(o *options) error {
+		o.recover = true
+		return nil
+	}
+}
+
+// Creates and starts an instance, filling in defaults for everything not
+// configured by the options. The configuration and listen address are
+// validated before anything is created, see `ValidateStart()`.
+//
+// Event handlers and loggers with a `Bind()` method, such as
+// `AccessControl` and `Diagnostics`, are bound to the instance, and the FD
+// resolver is installed, before `Start()` is called. Decorators of this
+// package are looked through, so a `Bind()` method is found at any depth,
+// e.g. in `NewDiagnostics(logger, NewAccessControl(app, policy, audit), cfg)`.
+func New(opts ...Option) (*NordDrop, error) {
+	o := options{
+		addr:   DefaultListenAddr,
+		config: DefaultConfig(),
+	}
+	for _, opt := range opts {
+		if err := opt(&o); err != nil {
+			return nil, err
+		}
+	}
+
+	if !o.noStart {
+		if err := ValidateStart(o.addr, o.config); err != nil {
+			return nil, err
+		}
+	}
+	if o.events == nil {
+		o.events = EventCallbackFunc(func(Event) {})
+	}
+	if o.logger == nil {
+		o.logger = discardLogger{}
+	}
+	if o.keyStore == nil {
+		keyStore, err := newEphemeralKeyStore()
+		if err != nil {
+			return nil, err
+		}
+		o.keyStore = keyStore
+	}
+
+	newDrop := NewNordDrop
+	if o.recover {
+		newDrop = newNordDropRecovering
+	}
+	drop, err := newDrop(o.events, o.keyStore, o.logger)
+	if err != nil {
+		return nil, err
+	}
+	bindToDrop(o.events, drop, o.config)
+	bindToDrop(o.logger, drop, o.config)
+
+	if o.fdResolver != nil {
+		if err := drop.SetFdResolver(o.fdResolver); err != nil {
+			drop.Destroy()
+			return nil, err
+		}
+	}
+	if o.noStart {
+		return drop, nil
+	}
+	if err := drop.Start(o.addr, o.config); err != nil {
+		drop.Destroy()
+		return nil, err
+	}
+	return drop, nil
+}
+
+// Implemented by the decorators of this package, returns the event
+// callbacks and loggers they pass calls on to
+type decorator interface {
+	wrapped() []any
+}
+
+// Binds decorators such as `AccessControl` and `Diagnostics`, along with
+// everything they wrap
+func bindToDrop(target any, drop *NordDrop, config Config) {
+	switch b := target.(type) {
+	case interface{ Bind(*NordDrop) }:
+		b.Bind(drop)
+	case interface{ Bind(*NordDrop, Config) }:
+		b.Bind(drop, config)
+	}
+	if d, ok := target.(decorator); ok {
+		for _, inner := range d.wrapped() {
+			if inner != nil {
+				bindToDrop(inner, drop, config)
+			}
+		}
+	}
+}
+
+type discardLogger struct{}
+
+func (discardLogger) OnLog(LogLevel, string) {}
+
+func (discardLogger) Level() LogLevel {
+	return LogLevelCritical
+}
+
+type ephemeralKeyStore struct {
+	privkey []byte
+}
+
+func newEphemeralKeyStore() (*ephemeralKeyStore, error) {
+	privkey := make([]byte, keyFileKeySize)
+	if _, err := rand.Read(privkey); err != nil {
+		return nil, err
+	}
+	return &ephemeralKeyStore{privkey: privkey}, nil
+}
+
+func (k *ephemeralKeyStore) OnPubkey(peer string) *[]byte {
+	return nil
+}
+
+func (k *ephemeralKeyStore) Privkey() []byte {
+	return k.privkey
+}
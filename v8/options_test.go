@@ -0,0 +1,30 @@
+package norddrop
+
+import "testing"
+
+func TestBindToDropNested(t *testing.T) {
+	app := EventCallbackFunc(func(Event) {})
+	ac := NewAccessControl(app, AccessPolicy{}, nil)
+	pipeline := &Pipeline{next: ac}
+	diag := NewDiagnostics(NewDynamicLogger(nil, LogLevelInfo), pipeline, DiagnosticsConfig{})
+	inner := NewDiagnostics(nil, nil, DiagnosticsConfig{})
+	logger := NewRedactingLogger(NewDynamicLogger(inner, LogLevelInfo), NewRedactor())
+
+	drop := &NordDrop{}
+	config := DefaultConfig()
+	bindToDrop(diag, drop, config)
+	bindToDrop(logger, drop, config)
+
+	if got := ac.drop.Load(); got != drop {
+		t.Errorf("AccessControl bound to %p, want %p", got, drop)
+	}
+	if got := diag.drop.Load(); got != drop {
+		t.Errorf("Diagnostics bound to %p, want %p", got, drop)
+	}
+	if got := inner.drop.Load(); got != drop {
+		t.Errorf("inner Diagnostics bound to %p, want %p", got, drop)
+	}
+	if got := inner.dropConfig.Load(); got == nil || *got != config {
+		t.Errorf("inner Diagnostics config = %v, want %v", got, config)
+	}
+}
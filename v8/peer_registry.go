@@ -0,0 +1,390 @@
+package norddrop
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/netip"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A named device known to the `PeerRegistry`
+type Device struct {
+	// Stable device ID chosen by the application
+	ID string `json:"id"`
+	// Display name
+	Name string `json:"name"`
+	// Peer addresses the device is currently reachable at
+	Addresses []string `json:"addresses"`
+	// Device public key, used to follow the device across address changes
+	Pubkey []byte `json:"pubkey,omitempty"`
+	// Arbitrary application data
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// Last time an event or key lookup referred to the device
+	LastSeen time.Time `json:"last_seen"`
+}
+
+func (d *Device) clone() *Device {
+	c := *d
+	c.Addresses = append([]string(nil), d.Addresses...)
+	c.Pubkey = append([]byte(nil), d.Pubkey...)
+	if d.Metadata != nil {
+		c.Metadata = make(map[string]string, len(d.Metadata))
+		for k, v := range d.Metadata {
+			c.Metadata[k] = v
+		}
+	}
+	return &c
+}
+
+// An event together with the device of the transfer's peer. `Device` is
+// `nil` if the peer is not registered.
+type PeerEvent struct {
+	Event
+	Device *Device
+}
+
+// The event callback receiving events enriched by `PeerRegistry`
+type PeerEventCallback interface {
+	OnPeerEvent(event PeerEvent)
+}
+
+// A transfer together with the device of its peer. `Device` is `nil` if the
+// peer is not registered.
+type PeerTransferInfo struct {
+	TransferInfo
+	Device *Device
+}
+
+// Maps peer addresses to devices and persists them to a JSON file. All
+// mutating calls save the registry before returning.
+type PeerRegistry struct {
+	path string
+
+	mu        sync.RWMutex
+	devices   map[string]*Device
+	byAddr    map[string]string
+	transfers map[string]string
+}
+
+// Opens the registry stored at the given path. A missing file results in an
+// empty registry.
+func OpenPeerRegistry(path string) (*PeerRegistry, error) {
+	r := &PeerRegistry{
+		path:      path,
+		devices:   map[string]*Device{},
+		byAddr:    map[string]string{},
+		transfers: map[string]string{},
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var devices []*Device
+	if err := json.Unmarshal(data, &devices); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	for _, device := range devices {
+		if err := r.insert(device); err != nil {
+			return nil, fmt.Errorf("loading %s: %w", path, err)
+		}
+	}
+	return r, nil
+}
+
+func normalizePeerAddr(addr string) string {
+	if ip, err := netip.ParseAddr(strings.Trim(addr, "[]")); err == nil {
+		return ip.Unmap().String()
+	}
+	return addr
+}
+
+// Needs `r.mu` held for writing
+func (r *PeerRegistry) insert(device *Device) error {
+	if device.ID == "" {
+		return fmt.Errorf("device ID must not be empty")
+	}
+	if old, ok := r.devices[device.ID]; ok {
+		for _, addr := range old.Addresses {
+			delete(r.byAddr, addr)
+		}
+	}
+
+	addrs := make([]string, 0, len(device.Addresses))
+	for _, addr := range device.Addresses {
+		addr = normalizePeerAddr(addr)
+		r.detachAddr(addr)
+		r.byAddr[addr] = device.ID
+		addrs = append(addrs, addr)
+	}
+	device.Addresses = addrs
+	r.devices[device.ID] = device
+	return nil
+}
+
+// Removes the address from the device currently owning it. Needs `r.mu` held
+// for writing.
+func (r *PeerRegistry) detachAddr(addr string) {
+	id, ok := r.byAddr[addr]
+	if !ok {
+		return
+	}
+	delete(r.byAddr, addr)
+	if owner, ok := r.devices[id]; ok {
+		kept := owner.Addresses[:0]
+		for _, a := range owner.Addresses {
+			if a != addr {
+				kept = append(kept, a)
+			}
+		}
+		owner.Addresses = kept
+	}
+}
+
+// Adds or replaces the device. Its addresses are taken over from any other
+// device that had them.
+func (r *PeerRegistry) Add(device Device) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.insert(device.clone()); err != nil {
+		return err
+	}
+	return r.save()
+}
+
+// Removes the device
+func (r *PeerRegistry) Remove(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	device, ok := r.devices[id]
+	if !ok {
+		return nil
+	}
+	for _, addr := range device.Addresses {
+		delete(r.byAddr, addr)
+	}
+	delete(r.devices, id)
+	return r.save()
+}
+
+// Records that the device is now reachable at the given address, e.g. after
+// its IP changed. Previous addresses of the device are dropped.
+func (r *PeerRegistry) SetAddress(id string, addr string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.setAddress(id, addr); err != nil {
+		return err
+	}
+	return r.save()
+}
+
+// Needs `r.mu` held for writing
+func (r *PeerRegistry) setAddress(id string, addr string) error {
+	device, ok := r.devices[id]
+	if !ok {
+		return fmt.Errorf("unknown device %q", id)
+	}
+	addr = normalizePeerAddr(addr)
+	for _, old := range device.Addresses {
+		delete(r.byAddr, old)
+	}
+	r.detachAddr(addr)
+	device.Addresses = []string{addr}
+	r.byAddr[addr] = id
+	return nil
+}
+
+// Returns the device with the given ID
+func (r *PeerRegistry) Device(id string) (*Device, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	device, ok := r.devices[id]
+	if !ok {
+		return nil, false
+	}
+	return device.clone(), true
+}
+
+// Returns the device reachable at the given peer address
+func (r *PeerRegistry) Resolve(addr string) (*Device, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	device := r.resolve(addr)
+	if device == nil {
+		return nil, false
+	}
+	return device.clone(), true
+}
+
+// Needs `r.mu` held
+func (r *PeerRegistry) resolve(addr string) *Device {
+	id, ok := r.byAddr[normalizePeerAddr(addr)]
+	if !ok {
+		return nil
+	}
+	return r.devices[id]
+}
+
+// Returns all devices sorted by ID
+func (r *PeerRegistry) Devices() []*Device {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	devices := make([]*Device, 0, len(r.devices))
+	for _, device := range r.devices {
+		devices = append(devices, device.clone())
+	}
+	sort.Slice(devices, func(i, j int) bool { return devices[i].ID < devices[j].ID })
+	return devices
+}
+
+// Persists the registry, including the last seen timestamps updated by
+// events
+func (r *PeerRegistry) Save() error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.save()
+}
+
+// Needs `r.mu` held
+func (r *PeerRegistry) save() error {
+	devices := make([]*Device, 0, len(r.devices))
+	for _, device := range r.devices {
+		devices = append(devices, device)
+	}
+	sort.Slice(devices, func(i, j int) bool { return devices[i].ID < devices[j].ID })
+
+	data, err := json.MarshalIndent(devices, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(r.path, data, 0o600)
+}
+
+// Wraps the callback so that it receives events with the peer device
+// resolved. Events without a peer address are matched by their transfer ID.
+func (r *PeerRegistry) EventCallback(next PeerEventCallback) EventCallback {
+	return EventCallbackFunc(func(event Event) {
+		next.OnPeerEvent(PeerEvent{
+			Event:  event,
+			Device: r.resolveEvent(event),
+		})
+	})
+}
+
+func (r *PeerRegistry) resolveEvent(event Event) *Device {
+	peer := ""
+	switch k := event.Kind.(type) {
+	case EventKindRequestReceived:
+		peer = k.Peer
+	case EventKindRequestQueued:
+		peer = k.Peer
+	case EventKindTransferDeferred:
+		peer = k.Peer
+	}
+	transferId, hasTransfer := eventTransferId(event.Kind)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var device *Device
+	if peer != "" {
+		device = r.resolve(peer)
+		if device != nil && hasTransfer {
+			r.transfers[transferId] = device.ID
+		}
+	} else if hasTransfer {
+		device = r.devices[r.transfers[transferId]]
+	}
+	if _, ok := event.Kind.(EventKindTransferFinalized); ok {
+		delete(r.transfers, transferId)
+	}
+
+	if device == nil {
+		return nil
+	}
+	device.LastSeen = time.UnixMilli(event.Timestamp)
+	return device.clone()
+}
+
+// Resolves the peer devices of transfers returned by `TransfersSince()`
+func (r *PeerRegistry) ResolveTransfers(transfers []TransferInfo) []PeerTransferInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	resolved := make([]PeerTransferInfo, 0, len(transfers))
+	for _, info := range transfers {
+		var device *Device
+		if d := r.resolve(info.Peer); d != nil {
+			device = d.clone()
+		} else if d, ok := r.devices[r.transfers[info.Id]]; ok {
+			device = d.clone()
+		}
+		resolved = append(resolved, PeerTransferInfo{TransferInfo: info, Device: device})
+	}
+	return resolved
+}
+
+// Wraps the KeyStore so that the registry and key lookups stay consistent.
+// Registered devices with a public key are answered from the registry. When
+// `fallback` returns a key belonging to a registered device for a new address
+// the device is moved to that address.
+func (r *PeerRegistry) KeyStore(fallback KeyStore) KeyStore {
+	return &registryKeyStore{registry: r, fallback: fallback}
+}
+
+type registryKeyStore struct {
+	registry *PeerRegistry
+	fallback KeyStore
+}
+
+func (ks *registryKeyStore) OnPubkey(peer string) *[]byte {
+	r := ks.registry
+
+	r.mu.Lock()
+	if device := r.resolve(peer); device != nil && len(device.Pubkey) > 0 {
+		device.LastSeen = time.Now()
+		pubkey := append([]byte(nil), device.Pubkey...)
+		r.mu.Unlock()
+		return &pubkey
+	}
+	r.mu.Unlock()
+
+	pubkey := ks.fallback.OnPubkey(peer)
+	if pubkey == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id, device := range r.devices {
+		if len(device.Pubkey) > 0 && bytes.Equal(device.Pubkey, *pubkey) {
+			if r.setAddress(id, peer) == nil {
+				device.LastSeen = time.Now()
+				_ = r.save()
+			}
+			break
+		}
+	}
+	return pubkey
+}
+
+func (ks *registryKeyStore) Privkey() []byte {
+	return ks.fallback.Privkey()
+}
@@ -0,0 +1,597 @@
+package norddrop
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A downloaded file passed through the pipeline stages
+type PipelineFile struct {
+	TransferId string
+	FileId     string
+	// Current location, stages moving the file update it
+	Path string
+	// Values recorded by the stages, e.g. `sha256`
+	Values map[string]string
+
+	checkpoint func()
+}
+
+// Persists `Values` right away instead of after the stage. Stages acting in
+// several steps record their progress with it, so that a rerun after a
+// crash can tell which steps are done.
+func (f *PipelineFile) Checkpoint() {
+	if f.checkpoint != nil {
+		f.checkpoint()
+	}
+}
+
+// A single processing step. Stages should honor context cancellation and be
+// safe to run again: after a crash the interrupted stage is rerun.
+type Stage interface {
+	Name() string
+	Run(ctx context.Context, file *PipelineFile) error
+}
+
+type stageFunc struct {
+	name string
+	fn   func(ctx context.Context, file *PipelineFile) error
+}
+
+func (s stageFunc) Name() string {
+	return s.name
+}
+
+func (s stageFunc) Run(ctx context.Context, file *PipelineFile) error {
+	return s.fn(ctx, file)
+}
+
+// Adapts an ordinary function to the `Stage` interface
+func StageFunc(name string, fn func(ctx context.Context, file *PipelineFile) error) Stage {
+	return stageFunc{name: name, fn: fn}
+}
+
+// What happens with a file when one of its stages fails
+type FailurePolicy uint
+
+const (
+	// Stop processing the file
+	FailureAbort FailurePolicy = iota
+	// Record the failure and run the next stage
+	FailureContinue
+)
+
+// A stage with its execution settings
+type PipelineStage struct {
+	Stage Stage
+	// Limit of a single attempt, unlimited if zero
+	Timeout time.Duration
+	// Additional attempts before the failure policy applies
+	Retries   int
+	OnFailure FailurePolicy
+}
+
+// Outcome of a single stage
+type StageResult struct {
+	Name     string    `json:"name"`
+	Failed   bool      `json:"failed"`
+	Error    string    `json:"error,omitempty"`
+	Attempts int       `json:"attempts"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+}
+
+// Processing state of a single downloaded file
+type PipelineResult struct {
+	TransferId string            `json:"transfer_id"`
+	FileId     string            `json:"file_id"`
+	FinalPath  string            `json:"final_path"`
+	Path       string            `json:"path"`
+	Values     map[string]string `json:"values,omitempty"`
+	Stages     []StageResult     `json:"stages"`
+	Done       bool              `json:"done"`
+	Failed     bool              `json:"failed"`
+}
+
+// EventCallback decorator running the stages in order on every file after
+// `EventKindFileDownloaded`. Files are processed concurrently, the stages
+// of a single file sequentially.
+//
+// Per-file results are persisted after every stage so `Resume()` continues
+// unfinished files after a crash.
+type Pipeline struct {
+	next      EventCallback
+	stages    []PipelineStage
+	statePath string
+	onDone    func(PipelineResult)
+
+	mu      sync.Mutex
+	results map[string]*PipelineResult
+	running map[string]bool
+	wg      sync.WaitGroup
+	// Serializes snapshots with their writes so an older snapshot never
+	// overwrites a newer one
+	saveMu sync.Mutex
+}
+
+// # Arguments
+// * `next` - Callback receiving all events, may be `nil`
+// * `statePath` - JSON file keeping the per-file results, not persisted if empty
+// * `onDone` - Called once a file finished all stages or was aborted, may be `nil`
+// * `stages` - Stages in execution order
+func NewPipeline(next EventCallback, statePath string, onDone func(PipelineResult), stages ...PipelineStage) (*Pipeline, error) {
+	p := &Pipeline{
+		next:      next,
+		stages:    stages,
+		statePath: statePath,
+		onDone:    onDone,
+		results:   map[string]*PipelineResult{},
+		running:   map[string]bool{},
+	}
+	if statePath == "" {
+		return p, nil
+	}
+
+	data, err := os.ReadFile(statePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return p, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("loading %s: %w", statePath, err)
+	}
+	var results []*PipelineResult
+	if err := json.Unmarshal(data, &results); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", statePath, err)
+	}
+	for _, result := range results {
+		p.results[pipelineKey(result.TransferId, result.FileId)] = result
+	}
+	return p, nil
+}
+
+func pipelineKey(transferId string, fileId string) string {
+	return transferId + "/" + fileId
+}
+
+func (p *Pipeline) wrapped() []any {
+	return []any{p.next}
+}
+
+func (p *Pipeline) OnEvent(event Event) {
+	if k, ok := event.Kind.(EventKindFileDownloaded); ok {
+		p.start(&PipelineResult{
+			TransferId: k.TransferId,
+			FileId:     k.FileId,
+			FinalPath:  k.FinalPath,
+			Path:       k.FinalPath,
+		})
+	}
+	if p.next != nil {
+		p.next.OnEvent(event)
+	}
+}
+
+// Continues processing the files which have not finished before the last
+// shutdown
+func (p *Pipeline) Resume() {
+	p.mu.Lock()
+	var pending []*PipelineResult
+	for _, result := range p.results {
+		if !result.Done {
+			pending = append(pending, result)
+		}
+	}
+	p.mu.Unlock()
+
+	for _, result := range pending {
+		p.start(result)
+	}
+}
+
+func (p *Pipeline) start(result *PipelineResult) {
+	key := pipelineKey(result.TransferId, result.FileId)
+
+	p.mu.Lock()
+	if p.running[key] {
+		p.mu.Unlock()
+		return
+	}
+	p.running[key] = true
+	p.results[key] = result
+	p.mu.Unlock()
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		p.process(result)
+
+		p.mu.Lock()
+		delete(p.running, key)
+		p.mu.Unlock()
+	}()
+}
+
+// Only the goroutine processing the result modifies it, under `p.mu` so
+// `save()` and `Results()` see consistent copies
+func (p *Pipeline) process(result *PipelineResult) {
+	file := &PipelineFile{
+		TransferId: result.TransferId,
+		FileId:     result.FileId,
+		Path:       result.Path,
+		Values:     map[string]string{},
+	}
+	for k, v := range result.Values {
+		file.Values[k] = v
+	}
+	file.checkpoint = func() {
+		p.mu.Lock()
+		result.Values = copyValues(file.Values)
+		p.mu.Unlock()
+		p.save()
+	}
+
+	for i := len(result.Stages); i < len(p.stages); i++ {
+		stage := p.stages[i]
+		stageResult := StageResult{Name: stage.Stage.Name(), Started: time.Now()}
+
+		var err error
+		for attempt := 0; attempt <= stage.Retries; attempt++ {
+			stageResult.Attempts++
+			if err = p.runStage(stage, file); err == nil {
+				break
+			}
+		}
+		stageResult.Finished = time.Now()
+		if err != nil {
+			stageResult.Failed = true
+			stageResult.Error = err.Error()
+		}
+		abort := err != nil && stage.OnFailure == FailureAbort
+
+		p.mu.Lock()
+		result.Stages = append(result.Stages, stageResult)
+		result.Path = file.Path
+		result.Values = copyValues(file.Values)
+		if err != nil {
+			result.Failed = true
+		}
+		p.mu.Unlock()
+		p.save()
+
+		if abort {
+			break
+		}
+	}
+
+	p.mu.Lock()
+	result.Done = true
+	done := *result
+	p.mu.Unlock()
+	p.save()
+
+	if p.onDone != nil {
+		p.onDone(done)
+	}
+}
+
+func (p *Pipeline) runStage(stage PipelineStage, file *PipelineFile) (err error) {
+	ctx := context.Background()
+	if stage.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, stage.Timeout)
+		defer cancel()
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("stage %s panicked: %v", stage.Stage.Name(), r)
+		}
+		if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			err = fmt.Errorf("stage %s timed out after %s: %w", stage.Stage.Name(), stage.Timeout, err)
+		}
+	}()
+	return stage.Stage.Run(ctx, file)
+}
+
+func copyValues(values map[string]string) map[string]string {
+	copied := make(map[string]string, len(values))
+	for k, v := range values {
+		copied[k] = v
+	}
+	return copied
+}
+
+func (p *Pipeline) save() {
+	if p.statePath == "" {
+		return
+	}
+	p.saveMu.Lock()
+	defer p.saveMu.Unlock()
+
+	p.mu.Lock()
+	results := make([]*PipelineResult, 0, len(p.results))
+	for _, result := range p.results {
+		copied := *result
+		copied.Stages = append([]StageResult(nil), result.Stages...)
+		copied.Values = copyValues(result.Values)
+		results = append(results, &copied)
+	}
+	p.mu.Unlock()
+
+	// A failed save only costs resumability, processing goes on
+	if data, err := json.Marshal(results); err == nil {
+		_ = writeFileAtomic(p.statePath, data, 0o600)
+	}
+}
+
+// Returns the state of every known file
+func (p *Pipeline) Results() []PipelineResult {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	results := make([]PipelineResult, 0, len(p.results))
+	for _, result := range p.results {
+		copied := *result
+		copied.Stages = append([]StageResult(nil), result.Stages...)
+		copied.Values = copyValues(result.Values)
+		results = append(results, copied)
+	}
+	return results
+}
+
+// Forgets finished files so the state file does not grow without bound
+func (p *Pipeline) PruneDone() {
+	p.mu.Lock()
+	for key, result := range p.results {
+		if result.Done {
+			delete(p.results, key)
+		}
+	}
+	p.mu.Unlock()
+	p.save()
+}
+
+// Blocks until all files being processed are done
+func (p *Pipeline) Wait() {
+	p.wg.Wait()
+}
+
+// Runs an external command. `{path}`, `{transfer_id}` and `{file_id}` in
+// the arguments are replaced with the file's values, which are also exposed
+// as the `NORDDROP_PATH`, `NORDDROP_TRANSFER_ID` and `NORDDROP_FILE_ID`
+// environment variables. A non-zero exit status fails the stage. The
+// trimmed standard output is recorded as the value named after the stage.
+func CommandStage(name string, argv ...string) Stage {
+	return StageFunc(name, func(ctx context.Context, file *PipelineFile) error {
+		if len(argv) == 0 {
+			return fmt.Errorf("stage %s has no command", name)
+		}
+		replacer := strings.NewReplacer("{path}", file.Path, "{transfer_id}", file.TransferId, "{file_id}", file.FileId)
+		args := make([]string, len(argv))
+		for i, arg := range argv {
+			args[i] = replacer.Replace(arg)
+		}
+
+		var stdout, stderr bytes.Buffer
+		cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+		cmd.Env = append(os.Environ(),
+			"NORDDROP_PATH="+file.Path,
+			"NORDDROP_TRANSFER_ID="+file.TransferId,
+			"NORDDROP_FILE_ID="+file.FileId,
+		)
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			if msg := strings.TrimSpace(stderr.String()); msg != "" {
+				return fmt.Errorf("%w: %s", err, msg)
+			}
+			return err
+		}
+		if out := strings.TrimSpace(stdout.String()); out != "" {
+			file.Values[name] = out
+		}
+		return nil
+	})
+}
+
+// Moves the file into `dir`, picking an unused name if the file name is
+// taken. Files are copied when `dir` is on another file system.
+func MoveStage(dir string) Stage {
+	return RenameStage("move", func(file *PipelineFile) string {
+		return filepath.Join(dir, filepath.Base(file.Path))
+	})
+}
+
+// Moves the file to the path returned by `target`. Missing directories are
+// created and an unused name is picked if the path is taken.
+//
+// The picked path is checkpointed as the `<name>.pending` value before the
+// file is moved. A rerun finding the file gone and the pending path present
+// completes the stage, one finding both removes the partial copy and moves
+// the file again.
+func RenameStage(name string, target func(file *PipelineFile) string) Stage {
+	pendingKey := name + ".pending"
+	return StageFunc(name, func(ctx context.Context, file *PipelineFile) error {
+		dest, resumed := file.Values[pendingKey]
+		if resumed {
+			if done, err := resumePending(file.Path, dest, os.Remove); done || err != nil {
+				if done {
+					file.Path = dest
+					delete(file.Values, pendingKey)
+				}
+				return err
+			}
+		} else {
+			dest = target(file)
+			if dest == file.Path {
+				return nil
+			}
+			if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+				return err
+			}
+			var err error
+			if dest, err = unusedFilePath(dest); err != nil {
+				return err
+			}
+			file.Values[pendingKey] = dest
+			file.Checkpoint()
+		}
+
+		if err := os.Rename(file.Path, dest); err != nil {
+			if err := copyFile(ctx, file.Path, dest); err != nil {
+				os.Remove(dest)
+				return err
+			}
+			if err := os.Remove(file.Path); err != nil {
+				return err
+			}
+		}
+		file.Path = dest
+		delete(file.Values, pendingKey)
+		return nil
+	})
+}
+
+// Checks the outcome of an interrupted stage which moves `src` to the
+// checkpointed `dest`: done when `src` is gone and `dest` exists. When `src`
+// still exists whatever was written to `dest` is incomplete and removed.
+func resumePending(src string, dest string, remove func(string) error) (bool, error) {
+	if _, err := os.Lstat(src); err != nil {
+		if !os.IsNotExist(err) {
+			return false, err
+		}
+		if _, err := os.Lstat(dest); err != nil {
+			return false, fmt.Errorf("%s is gone and %s was not created: %w", src, dest, err)
+		}
+		return true, nil
+	}
+	if err := remove(dest); err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	return false, nil
+}
+
+func copyFile(ctx context.Context, src string, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, contextReader{ctx, in}); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+// Records the hex SHA-256 of the file as the `sha256` value
+func ChecksumStage() Stage {
+	return StageFunc("checksum", func(ctx context.Context, file *PipelineFile) error {
+		f, err := os.Open(file.Path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		hash := sha256.New()
+		if _, err := io.Copy(hash, contextReader{ctx, f}); err != nil {
+			return err
+		}
+		file.Values["sha256"] = hex.EncodeToString(hash.Sum(nil))
+		return nil
+	})
+}
+
+// Unpacks tar archives, see `ArchiveUnpacker`, and continues with the
+// unpacked directory as the file's path. Other files pass unchanged.
+//
+// Like `RenameStage()` the directory is checkpointed as the `unpack.pending`
+// value first. A rerun finding the archive removed completes the stage, one
+// finding the archive removes the directory and unpacks again.
+func UnpackStage(removeArchive bool) Stage {
+	const pendingKey = "unpack.pending"
+	return StageFunc("unpack", func(ctx context.Context, file *PipelineFile) error {
+		ext := archiveExtension(file.Path)
+		if ext == "" {
+			return nil
+		}
+
+		dir, resumed := file.Values[pendingKey]
+		if resumed {
+			if done, err := resumePending(file.Path, dir, os.RemoveAll); done || err != nil {
+				if done {
+					file.Path = dir
+					delete(file.Values, pendingKey)
+				}
+				return err
+			}
+		} else {
+			var err error
+			if dir, err = unusedPath(strings.TrimSuffix(file.Path, ext)); err != nil {
+				return err
+			}
+			file.Values[pendingKey] = dir
+			file.Checkpoint()
+		}
+
+		if err := unpackInto(file.Path, dir, removeArchive); err != nil {
+			return err
+		}
+		file.Path = dir
+		delete(file.Values, pendingKey)
+		return nil
+	})
+}
+
+// Like `unusedPath()` but keeps the extension last: `a (1).txt`
+func unusedFilePath(path string) (string, error) {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	for i := 0; i < 1000; i++ {
+		candidate := path
+		if i > 0 {
+			candidate = fmt.Sprintf("%s (%d)%s", base, i, ext)
+		}
+		if _, err := os.Lstat(candidate); os.IsNotExist(err) {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("no unused name for %s", path)
+}
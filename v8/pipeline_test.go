@@ -0,0 +1,116 @@
+package norddrop
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTestFile(t *testing.T, path string, data string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRenameStageRerun(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "in", "a.txt")
+	dest := filepath.Join(dir, "out", "a.txt")
+	stage := MoveStage(filepath.Join(dir, "out"))
+
+	// Crashed after the rename, before the result was saved
+	writeTestFile(t, dest, "data")
+	file := &PipelineFile{Path: src, Values: map[string]string{"move.pending": dest}}
+	if err := stage.Run(context.Background(), file); err != nil {
+		t.Fatal(err)
+	}
+	if file.Path != dest {
+		t.Errorf("Path = %s, want %s", file.Path, dest)
+	}
+	if _, ok := file.Values["move.pending"]; ok {
+		t.Error("pending value kept")
+	}
+
+	// Crashed while copying, the partial copy is replaced
+	writeTestFile(t, src, "data")
+	writeTestFile(t, dest, "da")
+	file = &PipelineFile{Path: src, Values: map[string]string{"move.pending": dest}}
+	if err := stage.Run(context.Background(), file); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(dest); string(data) != "data" {
+		t.Errorf("destination holds %q", data)
+	}
+	if _, err := os.Stat(src); !os.IsNotExist(err) {
+		t.Errorf("source left behind: %v", err)
+	}
+
+	// Both gone is an error rather than success
+	file = &PipelineFile{Path: src, Values: map[string]string{"move.pending": filepath.Join(dir, "missing")}}
+	if err := stage.Run(context.Background(), file); err == nil {
+		t.Error("missing file reported as moved")
+	}
+}
+
+func TestRenameStageCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "a.txt")
+	writeTestFile(t, src, "data")
+
+	var checkpointed map[string]string
+	file := &PipelineFile{Path: src, Values: map[string]string{}}
+	file.checkpoint = func() { checkpointed = copyValues(file.Values) }
+
+	if err := MoveStage(filepath.Join(dir, "out")).Run(context.Background(), file); err != nil {
+		t.Fatal(err)
+	}
+	if got := checkpointed["move.pending"]; got != file.Path {
+		t.Errorf("checkpointed %q, file moved to %q", got, file.Path)
+	}
+}
+
+func TestUnpackStageRerun(t *testing.T) {
+	dir := t.TempDir()
+	tree := filepath.Join(dir, "tree")
+	writeTestFile(t, filepath.Join(tree, "a.txt"), "a")
+
+	var archive bytes.Buffer
+	if err := WriteArchive(&archive, tree, nil); err != nil {
+		t.Fatal(err)
+	}
+	archivePath := filepath.Join(dir, "recv", "tree.tar")
+	writeTestFile(t, archivePath, archive.String())
+	unpacked := filepath.Join(dir, "recv", "tree")
+
+	// Crashed after unpacking, before the archive was removed: the
+	// directory is unpacked again
+	writeTestFile(t, filepath.Join(unpacked, "partial"), "")
+	file := &PipelineFile{Path: archivePath, Values: map[string]string{"unpack.pending": unpacked}}
+	if err := UnpackStage(true).Run(context.Background(), file); err != nil {
+		t.Fatal(err)
+	}
+	if file.Path != unpacked {
+		t.Errorf("Path = %s, want %s", file.Path, unpacked)
+	}
+	if _, err := os.Stat(filepath.Join(unpacked, "partial")); !os.IsNotExist(err) {
+		t.Errorf("partial unpack kept: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(unpacked, "a.txt")); string(data) != "a" {
+		t.Errorf("a.txt holds %q", data)
+	}
+
+	// Crashed after the archive was removed
+	file = &PipelineFile{Path: archivePath, Values: map[string]string{"unpack.pending": unpacked}}
+	if err := UnpackStage(true).Run(context.Background(), file); err != nil {
+		t.Fatal(err)
+	}
+	if file.Path != unpacked {
+		t.Errorf("Path = %s, want %s", file.Path, unpacked)
+	}
+}
@@ -0,0 +1,254 @@
+package norddrop
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// A single redaction applied to log messages and event strings
+type RedactionRule interface {
+	Redact(s string) string
+}
+
+// Adapts an ordinary function to the `RedactionRule` interface
+type RedactionRuleFunc func(s string) string
+
+func (f RedactionRuleFunc) Redact(s string) string {
+	return f(s)
+}
+
+// Replaces every match of the pattern. The replacement may reference
+// submatches as in `regexp.Regexp.ReplaceAllString()`.
+func RegexRule(pattern *regexp.Regexp, replacement string) RedactionRule {
+	return RedactionRuleFunc(func(s string) string {
+		return pattern.ReplaceAllString(s, replacement)
+	})
+}
+
+// Paths may contain spaces, so a quoted path extends to the closing quote
+// and an unquoted one to the end of the line. Windows paths also end at a
+// colon followed by a space, since file names can't contain colons.
+var (
+	redactQuotedPath   = regexp.MustCompile(`"((?:~/|/|[A-Za-z]:\\)[^"\n]*)"|'((?:~/|/|[A-Za-z]:\\)[^'\n]*)'`)
+	redactUnixPath     = regexp.MustCompile(`(^|[\s"'=(\[])((?:~/|/)[^\s"'<>|][^\n]*)`)
+	redactWindowsPath  = regexp.MustCompile(`(^|[\s"'=(\[])([A-Za-z]:\\(?:[^\n:]|:\S)*)`)
+	redactPathExt      = regexp.MustCompile(`^\.[A-Za-z0-9]{1,10}$`)
+	redactIPv4         = regexp.MustCompile(`\b\d{1,3}(?:\.\d{1,3}){3}\b`)
+	redactIPv6         = regexp.MustCompile(`(^|[^0-9A-Za-z_:.])([0-9A-Fa-f]{0,4}(?::[0-9A-Fa-f]{0,4}){2,7})`)
+	redactBase64Run    = regexp.MustCompile(`(^|[^A-Za-z0-9+/_-])([A-Za-z0-9+/_-]{43,}={0,2})`)
+	redactBase64KeyLen = base64.RawStdEncoding.EncodedLen(32)
+)
+
+// Replaces absolute paths with `<path:HASH>` followed by the file extension.
+// The hash is a truncated HMAC-SHA256 keyed with `salt`, so the same path
+// always maps to the same token without being reversible.
+//
+// A quoted path is replaced up to the closing quote. As paths may contain
+// spaces, an unquoted Unix path is replaced up to the end of the line,
+// including whatever text follows it.
+func PathHashRule(salt []byte) RedactionRule {
+	hash := func(path string) string {
+		return hashPath(salt, path)
+	}
+	return RedactionRuleFunc(func(s string) string {
+		s = replaceSubmatch(redactQuotedPath, s, 1, hash)
+		s = replaceSubmatch(redactQuotedPath, s, 2, hash)
+		s = replaceSubmatch(redactUnixPath, s, 2, hash)
+		return replaceSubmatch(redactWindowsPath, s, 2, hash)
+	})
+}
+
+func hashPath(salt []byte, path string) string {
+	mac := hmac.New(sha256.New, salt)
+	mac.Write([]byte(path))
+	token := "<path:" + hex.EncodeToString(mac.Sum(nil))[:12] + ">"
+	// Only a plain extension, the path may run into the rest of the message
+	if ext := filepath.Ext(path); redactPathExt.MatchString(ext) {
+		token += ext
+	}
+	return token
+}
+
+// Truncates IPv4 addresses to their /24 network (`192.168.1.x`) and IPv6
+// addresses to their /48 network (`2001:db8:1::/48`)
+func IPTruncateRule() RedactionRule {
+	return RedactionRuleFunc(func(s string) string {
+		s = redactIPv4.ReplaceAllStringFunc(s, func(match string) string {
+			addr, err := netip.ParseAddr(match)
+			if err != nil {
+				return match
+			}
+			octets := addr.As4()
+			return fmt.Sprintf("%d.%d.%d.x", octets[0], octets[1], octets[2])
+		})
+		return replaceSubmatch(redactIPv6, s, 2, func(match string) string {
+			// Rust module paths (`drop_transfer::ws`) contain `::` as well
+			if !strings.ContainsAny(match, "0123456789") {
+				return match
+			}
+			addr, err := netip.ParseAddr(match)
+			if err != nil || !addr.Is6() {
+				return match
+			}
+			return netip.PrefixFrom(addr, 48).Masked().String()
+		})
+	})
+}
+
+// Replaces base64 (standard or URL alphabet) runs decoding to exactly 32
+// bytes, which is the size of libdrop keys, with `<key>`. Longer runs, such
+// as bigger secrets or hex encoded keys, are replaced with `<secret>` as a
+// whole. Note that libdrop file IDs have the key shape and are redacted as
+// well.
+func Base64KeyRule() RedactionRule {
+	return RedactionRuleFunc(func(s string) string {
+		return replaceSubmatch(redactBase64Run, s, 2, func(match string) string {
+			raw := strings.TrimRight(match, "=")
+			if len(raw) > redactBase64KeyLen {
+				return "<secret>"
+			}
+			decoded, err := base64.RawStdEncoding.DecodeString(raw)
+			if err != nil {
+				decoded, err = base64.RawURLEncoding.DecodeString(raw)
+			}
+			if err != nil || len(decoded) != 32 {
+				return match
+			}
+			return "<key>"
+		})
+	})
+}
+
+// Replaces submatch `group` of every match, leaving the rest of the match
+// intact. Used instead of lookbehind which `regexp` does not support.
+func replaceSubmatch(re *regexp.Regexp, s string, group int, replace func(string) string) string {
+	matches := re.FindAllStringSubmatchIndex(s, -1)
+	if matches == nil {
+		return s
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		start, end := m[2*group], m[2*group+1]
+		if start < 0 {
+			continue
+		}
+		b.WriteString(s[last:start])
+		b.WriteString(replace(s[start:end]))
+		last = end
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+// Applies redaction rules in order
+type Redactor struct {
+	rules      []RedactionRule
+	pathSalt   []byte
+	pathFields map[string]bool
+}
+
+func NewRedactor(rules ...RedactionRule) *Redactor {
+	return &Redactor{rules: rules}
+}
+
+// Redactor with key detection, path hashing and IP truncation, in that
+// order. In JSON documents the path fields of libdrop events and transfers
+// are hashed as a whole, since relative paths are not recognized by the
+// rules.
+func DefaultRedactor(salt []byte) *Redactor {
+	r := NewRedactor(Base64KeyRule(), PathHashRule(salt), IPTruncateRule())
+	return r.WithPathFields(salt, "Path", "RelativePath", "FinalPath", "BasePath", "BaseDir", "Filename")
+}
+
+// Makes `JSON()` replace the values of the named object keys with a salted
+// path hash, whatever their content
+func (r *Redactor) WithPathFields(salt []byte, names ...string) *Redactor {
+	r.pathSalt = salt
+	r.pathFields = make(map[string]bool, len(names))
+	for _, name := range names {
+		r.pathFields[name] = true
+	}
+	return r
+}
+
+// Redacts a single string
+func (r *Redactor) String(s string) string {
+	for _, rule := range r.rules {
+		s = rule.Redact(s)
+	}
+	return s
+}
+
+// Redacts every string value in the JSON document. Object keys, numbers and
+// booleans are kept.
+func (r *Redactor) JSON(data []byte) ([]byte, error) {
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+	return json.Marshal(r.value(value))
+}
+
+func (r *Redactor) value(value any) any {
+	switch v := value.(type) {
+	case string:
+		return r.String(v)
+	case []any:
+		for i := range v {
+			v[i] = r.value(v[i])
+		}
+		return v
+	case map[string]any:
+		for key := range v {
+			if path, ok := v[key].(string); ok && path != "" && r.pathFields[key] {
+				v[key] = hashPath(r.pathSalt, path)
+				continue
+			}
+			v[key] = r.value(v[key])
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// Encodes the event as JSON, see `Event.MarshalJSON()`, and redacts it
+func (r *Redactor) Event(event Event) ([]byte, error) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+	return r.JSON(data)
+}
+
+type redactingLogger struct {
+	next     Logger
+	redactor *Redactor
+}
+
+// Logger decorator redacting every message before passing it on
+func NewRedactingLogger(next Logger, redactor *Redactor) Logger {
+	return &redactingLogger{next: next, redactor: redactor}
+}
+
+func (l *redactingLogger) wrapped() []any {
+	return []any{l.next}
+}
+
+func (l *redactingLogger) OnLog(level LogLevel, msg string) {
+	l.next.OnLog(level, l.redactor.String(msg))
+}
+
+func (l *redactingLogger) Level() LogLevel {
+	return l.next.Level()
+}
@@ -0,0 +1,145 @@
+package norddrop
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+type recordingLogger struct {
+	msgs []string
+}
+
+func (l *recordingLogger) OnLog(level LogLevel, msg string) {
+	l.msgs = append(l.msgs, msg)
+}
+
+func (l *recordingLogger) Level() LogLevel {
+	return LogLevelTrace
+}
+
+func randomBytes(t *testing.T, n int) []byte {
+	t.Helper()
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func assertRedacted(t *testing.T, out string, secrets ...string) {
+	t.Helper()
+	for _, secret := range secrets {
+		if strings.Contains(out, secret) {
+			t.Errorf("%q leaks %q", out, secret)
+		}
+	}
+}
+
+func TestRedactingLogger(t *testing.T) {
+	key := base64.StdEncoding.EncodeToString(randomBytes(t, 32))
+	rawKey := base64.RawURLEncoding.EncodeToString(randomBytes(t, 32))
+	longSecret := base64.RawStdEncoding.EncodeToString(randomBytes(t, 48))
+	hexKey := hex.EncodeToString(randomBytes(t, 32))
+
+	tests := []struct {
+		msg     string
+		secrets []string
+	}{
+		{"Failed to open /home/John Smith/Documents/tax return.pdf", []string{"John", "Smith", "Documents", "tax", "return"}},
+		{"Failed to open \"/home/John Smith/tax return.pdf\": No such file", []string{"John", "Smith", "tax", "return"}},
+		{"path='/srv/shared dir/a b.txt' size=3", []string{"shared", "dir", "a b"}},
+		{"Unterminated \"/home/John Smith/x", []string{"John", "Smith"}},
+		{`Failed to open C:\Users\John Smith\tax return.pdf`, []string{"John", "Smith", "tax", "return"}},
+		{`Failed to open C:\Users\John Smith\tax return.pdf: Access is denied`, []string{"John", "Smith", "tax", "return"}},
+		{"Connecting to 192.168.17.42:49111", []string{"192.168.17.42", ".42"}},
+		{"Connecting to [2001:db8:abcd:12::7]:49111", []string{"2001:db8:abcd:12::7", ":12::7"}},
+		{"Private key " + key, []string{key, key[:20], key[23:]}},
+		{"peer key=" + rawKey + ".", []string{rawKey, rawKey[:20], rawKey[23:]}},
+		{"Secret " + longSecret + " in use", []string{longSecret[:20], longSecret[43:]}},
+		{"Hex key " + hexKey, []string{hexKey[:20], hexKey[43:]}},
+	}
+
+	next := &recordingLogger{}
+	logger := NewRedactingLogger(next, DefaultRedactor([]byte("salt")))
+	for _, tt := range tests {
+		logger.OnLog(LogLevelInfo, tt.msg)
+		out := next.msgs[len(next.msgs)-1]
+		assertRedacted(t, out, tt.secrets...)
+	}
+}
+
+func TestRedactingLoggerKeepsText(t *testing.T) {
+	tests := []string{
+		"Transfer 3fa85f64-5717-4562-b3fc-2c963f66afa6 finished",
+		"[drop_transfer::ws::server] Listening",
+		"sent 3/4 files",
+	}
+
+	next := &recordingLogger{}
+	logger := NewRedactingLogger(next, DefaultRedactor([]byte("salt")))
+	for _, msg := range tests {
+		logger.OnLog(LogLevelInfo, msg)
+		if out := next.msgs[len(next.msgs)-1]; out != msg {
+			t.Errorf("%q redacted to %q", msg, out)
+		}
+	}
+}
+
+func TestPathHashRuleStable(t *testing.T) {
+	rule := PathHashRule([]byte("salt"))
+	a := rule.Redact("open /home/John Smith/tax return.pdf")
+	b := rule.Redact("open /home/John Smith/tax return.pdf")
+	if a != b {
+		t.Errorf("same path hashed differently: %q, %q", a, b)
+	}
+	if !strings.HasSuffix(a, ">.pdf") {
+		t.Errorf("extension not kept: %q", a)
+	}
+	if c := PathHashRule([]byte("other")).Redact("open /home/John Smith/tax return.pdf"); c == a {
+		t.Errorf("salt ignored: %q", c)
+	}
+}
+
+func TestRedactorEvent(t *testing.T) {
+	key := base64.RawStdEncoding.EncodeToString(randomBytes(t, 32))
+	osErr := int32(2)
+
+	events := []Event{
+		{Timestamp: 1, Kind: EventKindRequestReceived{
+			Peer:       "192.168.17.42",
+			TransferId: "3fa85f64-5717-4562-b3fc-2c963f66afa6",
+			Files: []ReceivedFile{
+				{Id: key, Path: "John Smith/tax return.pdf", Size: 10},
+			},
+		}},
+		{Timestamp: 2, Kind: EventKindRequestQueued{
+			Peer:       "2001:db8:abcd:12::7",
+			TransferId: "3fa85f64-5717-4562-b3fc-2c963f66afa6",
+			Files: []QueuedFile{
+				{Id: key, Path: "tax return.pdf", Size: 10},
+			},
+		}},
+		{Timestamp: 3, Kind: EventKindFileDownloaded{
+			TransferId: "3fa85f64-5717-4562-b3fc-2c963f66afa6",
+			FileId:     key,
+			FinalPath:  "/home/John Smith/Downloads/tax return.pdf",
+		}},
+		{Timestamp: 4, Kind: EventKindFileFailed{
+			TransferId: "3fa85f64-5717-4562-b3fc-2c963f66afa6",
+			FileId:     key,
+			Status:     Status{Status: StatusCodeIoError, OsErrorCode: &osErr},
+		}},
+	}
+
+	redactor := DefaultRedactor([]byte("salt"))
+	for _, event := range events {
+		data, err := redactor.Event(event)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertRedacted(t, string(data), "John", "Smith", "tax", "return", "192.168.17.42", ":12::7", key)
+	}
+}
@@ -0,0 +1,96 @@
+package norddrop
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// Err* are used for checking error type with `errors.Is`
+var ErrRustPanic = fmt.Errorf("RustPanic")
+var ErrInstancePoisoned = fmt.Errorf("InstancePoisoned")
+
+// Panic raised by libdrop. Without panic recovery it is the value the
+// binding panics with, see `NordDrop.RecoverPanics()`.
+type RustPanicError struct {
+	Message string
+}
+
+func (e *RustPanicError) Error() string {
+	return fmt.Sprintf("libdrop panicked: %s", e.Message)
+}
+
+func (e *RustPanicError) Is(target error) bool {
+	return target == ErrRustPanic
+}
+
+// Returned by every call on an instance poisoned by an earlier panic. It
+// unwraps to the `*RustPanicError` which poisoned the instance.
+type PoisonedError struct {
+	Cause *RustPanicError
+}
+
+func (e *PoisonedError) Error() string {
+	return fmt.Sprintf("instance is poisoned by an earlier panic: %s", e.Cause.Message)
+}
+
+func (e *PoisonedError) Is(target error) bool {
+	return target == ErrInstancePoisoned
+}
+
+func (e *PoisonedError) Unwrap() error {
+	return e.Cause
+}
+
+type panicGuard struct {
+	enabled  atomic.Bool
+	poisoned atomic.Pointer[RustPanicError]
+}
+
+// Converts the recovered value and poisons the instance, the first panic
+// is kept as the cause
+func (g *panicGuard) poison(r any) error {
+	err, ok := r.(*RustPanicError)
+	if !ok {
+		err = &RustPanicError{Message: fmt.Sprint(r)}
+	}
+	g.poisoned.CompareAndSwap(nil, err)
+	return err
+}
+
+// Makes the methods return panics raised during the call as
+// `*RustPanicError` instead of panicking. The state of libdrop after a
+// panic is unknown, so the instance is poisoned and every following call
+// returns `*PoisonedError` without reaching libdrop. Only `Destroy()` is
+// still meaningful on a poisoned instance.
+//
+// Panics while lifting the results are not covered, unknown enum variants
+// are reported as `*UnknownVariantError` regardless.
+func (_self *NordDrop) RecoverPanics() {
+	_self.panics.enabled.Store(true)
+}
+
+// Returns `*PoisonedError` if a recovered panic poisoned the instance, `nil`
+// otherwise
+func (_self *NordDrop) Poisoned() error {
+	if cause := _self.panics.poisoned.Load(); cause != nil {
+		return &PoisonedError{Cause: cause}
+	}
+	return nil
+}
+
+// Like `NewNordDrop()`, but a panic in the constructor is returned as
+// `*RustPanicError` and the created instance has panic recovery enabled
+func newNordDropRecovering(eventCb EventCallback, keyStore KeyStore, logger Logger) (drop *NordDrop, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			var guard panicGuard
+			drop, err = nil, guard.poison(r)
+		}
+	}()
+	drop, err = NewNordDrop(eventCb, keyStore, logger)
+	if err != nil {
+		return nil, err
+	}
+	drop.RecoverPanics()
+	return drop, nil
+}
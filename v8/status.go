@@ -0,0 +1,333 @@
+package norddrop
+
+import (
+	"fmt"
+	"io/fs"
+	"regexp"
+	"strings"
+	"syscall"
+)
+
+var statusCodeNames = map[StatusCode]string{
+	StatusCodeFinalized:              "Finalized",
+	StatusCodeBadPath:                "BadPath",
+	StatusCodeBadFile:                "BadFile",
+	StatusCodeBadTransfer:            "BadTransfer",
+	StatusCodeBadTransferState:       "BadTransferState",
+	StatusCodeBadFileId:              "BadFileId",
+	StatusCodeIoError:                "IoError",
+	StatusCodeTransferLimitsExceeded: "TransferLimitsExceeded",
+	StatusCodeMismatchedSize:         "MismatchedSize",
+	StatusCodeInvalidArgument:        "InvalidArgument",
+	StatusCodeAddrInUse:              "AddrInUse",
+	StatusCodeFileModified:           "FileModified",
+	StatusCodeFilenameTooLong:        "FilenameTooLong",
+	StatusCodeAuthenticationFailed:   "AuthenticationFailed",
+	StatusCodeStorageError:           "StorageError",
+	StatusCodeDbLost:                 "DbLost",
+	StatusCodeFileChecksumMismatch:   "FileChecksumMismatch",
+	StatusCodeFileRejected:           "FileRejected",
+	StatusCodeFileFailed:             "FileFailed",
+	StatusCodeFileFinished:           "FileFinished",
+	StatusCodeEmptyTransfer:          "EmptyTransfer",
+	StatusCodeConnectionClosedByPeer: "ConnectionClosedByPeer",
+	StatusCodeTooManyRequests:        "TooManyRequests",
+	StatusCodePermissionDenied:       "PermissionDenied",
+}
+
+// Returns the code name without the `StatusCode` prefix, e.g. `BadPath`
+func (c StatusCode) String() string {
+	if c == StatusCodeUnknown {
+		return "Unknown"
+	}
+	if name, ok := statusCodeNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("StatusCode(%d)", uint(c))
+}
+
+var statusMessageIDWord = regexp.MustCompile(`[A-Z][a-z]*`)
+
+// Stable key of the code's message for translation catalogs, e.g.
+// `status.bad_path`
+func (c StatusCode) MessageID() string {
+	name, ok := statusCodeNames[c]
+	if !ok {
+		return fmt.Sprintf("status.unknown_%d", uint(c))
+	}
+	words := statusMessageIDWord.FindAllString(name, -1)
+	return "status." + strings.ToLower(strings.Join(words, "_"))
+}
+
+// Maps status codes to user facing messages. Translations key their
+// entries with `StatusCode.MessageID()`.
+type StatusCatalog map[StatusCode]string
+
+// English messages of all status codes
+var DefaultStatusCatalog = StatusCatalog{
+	StatusCodeFinalized:              "The transfer was finalized.",
+	StatusCodeBadPath:                "The file path is invalid.",
+	StatusCodeBadFile:                "The file could not be opened or does not exist.",
+	StatusCodeBadTransfer:            "The transfer does not exist.",
+	StatusCodeBadTransferState:       "The transfer cannot continue because of an error, most likely on the peer's device.",
+	StatusCodeBadFileId:              "The file does not exist in the transfer.",
+	StatusCodeIoError:                "An input or output error occurred.",
+	StatusCodeTransferLimitsExceeded: "The transfer has too many files or too deeply nested directories.",
+	StatusCodeMismatchedSize:         "The file size changed since the file was added to the transfer.",
+	StatusCodeInvalidArgument:        "An invalid argument or configuration value was provided.",
+	StatusCodeAddrInUse:              "The listen address is already in use.",
+	StatusCodeFileModified:           "The file was modified while being sent.",
+	StatusCodeFilenameTooLong:        "The file name is too long for this file system.",
+	StatusCodeAuthenticationFailed:   "The peer could not be authenticated.",
+	StatusCodeStorageError:           "The transfer database could not be accessed.",
+	StatusCodeDbLost:                 "The transfer database was lost and a new one was created.",
+	StatusCodeFileChecksumMismatch:   "The downloaded file is corrupted and was deleted.",
+	StatusCodeFileRejected:           "The file was rejected.",
+	StatusCodeFileFailed:             "The file has already failed.",
+	StatusCodeFileFinished:           "The file has already been transferred.",
+	StatusCodeEmptyTransfer:          "The transfer has no files.",
+	StatusCodeConnectionClosedByPeer: "The peer closed the connection. The transfer can be resumed.",
+	StatusCodeTooManyRequests:        "The peer is receiving too many requests. Try again later.",
+	StatusCodePermissionDenied:       "Permission denied.",
+}
+
+// Returns the code's message from the catalog, falling back to
+// `DefaultStatusCatalog` for missing entries
+func (c StatusCode) Localize(catalog StatusCatalog) string {
+	if msg, ok := catalog[c]; ok {
+		return msg
+	}
+	if msg, ok := DefaultStatusCatalog[c]; ok {
+		return msg
+	}
+	return fmt.Sprintf("Unknown status %d.", uint(c))
+}
+
+// Returns the English message of the code
+func (c StatusCode) Message() string {
+	return c.Localize(DefaultStatusCatalog)
+}
+
+// Who can act upon a status code
+type StatusClass uint
+
+const (
+	// Not an error, `StatusCodeFinalized`
+	StatusClassNone StatusClass = iota
+	// Temporary, repeating the action later may succeed
+	StatusClassRetryable
+	// Caused by the application or user input, e.g. a bad path
+	StatusClassUser
+	// Caused by the peer or its device
+	StatusClassPeer
+	// Local failure which repeating does not fix
+	StatusClassFatal
+)
+
+func (c StatusClass) String() string {
+	switch c {
+	case StatusClassNone:
+		return "none"
+	case StatusClassRetryable:
+		return "retryable"
+	case StatusClassUser:
+		return "user"
+	case StatusClassPeer:
+		return "peer"
+	case StatusClassFatal:
+		return "fatal"
+	default:
+		return fmt.Sprintf("StatusClass(%d)", uint(c))
+	}
+}
+
+var statusCodeClasses = map[StatusCode]StatusClass{
+	StatusCodeFinalized:              StatusClassNone,
+	StatusCodeBadPath:                StatusClassUser,
+	StatusCodeBadFile:                StatusClassUser,
+	StatusCodeBadTransfer:            StatusClassUser,
+	StatusCodeBadTransferState:       StatusClassPeer,
+	StatusCodeBadFileId:              StatusClassUser,
+	StatusCodeIoError:                StatusClassFatal,
+	StatusCodeTransferLimitsExceeded: StatusClassUser,
+	StatusCodeMismatchedSize:         StatusClassUser,
+	StatusCodeInvalidArgument:        StatusClassUser,
+	StatusCodeAddrInUse:              StatusClassFatal,
+	StatusCodeFileModified:           StatusClassUser,
+	StatusCodeFilenameTooLong:        StatusClassPeer,
+	StatusCodeAuthenticationFailed:   StatusClassPeer,
+	StatusCodeStorageError:           StatusClassFatal,
+	StatusCodeDbLost:                 StatusClassFatal,
+	StatusCodeFileChecksumMismatch:   StatusClassRetryable,
+	StatusCodeFileRejected:           StatusClassUser,
+	StatusCodeFileFailed:             StatusClassUser,
+	StatusCodeFileFinished:           StatusClassUser,
+	StatusCodeEmptyTransfer:          StatusClassUser,
+	StatusCodeConnectionClosedByPeer: StatusClassRetryable,
+	StatusCodeTooManyRequests:        StatusClassRetryable,
+	StatusCodePermissionDenied:       StatusClassUser,
+}
+
+// Classifies the code, unknown codes are fatal
+func (c StatusCode) Class() StatusClass {
+	if class, ok := statusCodeClasses[c]; ok {
+		return class
+	}
+	return StatusClassFatal
+}
+
+// Reports whether repeating the action later may succeed
+func (c StatusCode) Retryable() bool {
+	return c.Class() == StatusClassRetryable
+}
+
+// Err* are used for checking error type with `errors.Is`
+var ErrStatusCodeFinalized = fmt.Errorf("StatusCodeFinalized")
+var ErrStatusCodeBadPath = fmt.Errorf("StatusCodeBadPath")
+var ErrStatusCodeBadFile = fmt.Errorf("StatusCodeBadFile")
+var ErrStatusCodeBadTransfer = fmt.Errorf("StatusCodeBadTransfer")
+var ErrStatusCodeBadTransferState = fmt.Errorf("StatusCodeBadTransferState")
+var ErrStatusCodeBadFileId = fmt.Errorf("StatusCodeBadFileId")
+var ErrStatusCodeIoError = fmt.Errorf("StatusCodeIoError")
+var ErrStatusCodeTransferLimitsExceeded = fmt.Errorf("StatusCodeTransferLimitsExceeded")
+var ErrStatusCodeMismatchedSize = fmt.Errorf("StatusCodeMismatchedSize")
+var ErrStatusCodeInvalidArgument = fmt.Errorf("StatusCodeInvalidArgument")
+var ErrStatusCodeAddrInUse = fmt.Errorf("StatusCodeAddrInUse")
+var ErrStatusCodeFileModified = fmt.Errorf("StatusCodeFileModified")
+var ErrStatusCodeFilenameTooLong = fmt.Errorf("StatusCodeFilenameTooLong")
+var ErrStatusCodeAuthenticationFailed = fmt.Errorf("StatusCodeAuthenticationFailed")
+var ErrStatusCodeStorageError = fmt.Errorf("StatusCodeStorageError")
+var ErrStatusCodeDbLost = fmt.Errorf("StatusCodeDbLost")
+var ErrStatusCodeFileChecksumMismatch = fmt.Errorf("StatusCodeFileChecksumMismatch")
+var ErrStatusCodeFileRejected = fmt.Errorf("StatusCodeFileRejected")
+var ErrStatusCodeFileFailed = fmt.Errorf("StatusCodeFileFailed")
+var ErrStatusCodeFileFinished = fmt.Errorf("StatusCodeFileFinished")
+var ErrStatusCodeEmptyTransfer = fmt.Errorf("StatusCodeEmptyTransfer")
+var ErrStatusCodeConnectionClosedByPeer = fmt.Errorf("StatusCodeConnectionClosedByPeer")
+var ErrStatusCodeTooManyRequests = fmt.Errorf("StatusCodeTooManyRequests")
+var ErrStatusCodePermissionDenied = fmt.Errorf("StatusCodePermissionDenied")
+var ErrStatusCodeUnknown = fmt.Errorf("StatusCodeUnknown")
+
+var statusCodeErrors = map[StatusCode]error{
+	StatusCodeFinalized:              ErrStatusCodeFinalized,
+	StatusCodeBadPath:                ErrStatusCodeBadPath,
+	StatusCodeBadFile:                ErrStatusCodeBadFile,
+	StatusCodeBadTransfer:            ErrStatusCodeBadTransfer,
+	StatusCodeBadTransferState:       ErrStatusCodeBadTransferState,
+	StatusCodeBadFileId:              ErrStatusCodeBadFileId,
+	StatusCodeIoError:                ErrStatusCodeIoError,
+	StatusCodeTransferLimitsExceeded: ErrStatusCodeTransferLimitsExceeded,
+	StatusCodeMismatchedSize:         ErrStatusCodeMismatchedSize,
+	StatusCodeInvalidArgument:        ErrStatusCodeInvalidArgument,
+	StatusCodeAddrInUse:              ErrStatusCodeAddrInUse,
+	StatusCodeFileModified:           ErrStatusCodeFileModified,
+	StatusCodeFilenameTooLong:        ErrStatusCodeFilenameTooLong,
+	StatusCodeAuthenticationFailed:   ErrStatusCodeAuthenticationFailed,
+	StatusCodeStorageError:           ErrStatusCodeStorageError,
+	StatusCodeDbLost:                 ErrStatusCodeDbLost,
+	StatusCodeFileChecksumMismatch:   ErrStatusCodeFileChecksumMismatch,
+	StatusCodeFileRejected:           ErrStatusCodeFileRejected,
+	StatusCodeFileFailed:             ErrStatusCodeFileFailed,
+	StatusCodeFileFinished:           ErrStatusCodeFileFinished,
+	StatusCodeEmptyTransfer:          ErrStatusCodeEmptyTransfer,
+	StatusCodeConnectionClosedByPeer: ErrStatusCodeConnectionClosedByPeer,
+	StatusCodeTooManyRequests:        ErrStatusCodeTooManyRequests,
+	StatusCodePermissionDenied:       ErrStatusCodePermissionDenied,
+}
+
+// Stands for every code added by a newer libdrop, see `Known()`. libdrop
+// never sends it.
+const StatusCodeUnknown StatusCode = 0
+
+// Reports whether the bindings know the code. Codes added by a newer libdrop
+// are decoded as their raw value, are named `StatusCode(N)` and classified
+// as fatal.
+func (c StatusCode) IsKnown() bool {
+	_, ok := statusCodeNames[c]
+	return ok
+}
+
+// Returns the code, or `StatusCodeUnknown` if the bindings don't know it.
+// Switching on `Known()` instead of the code itself keeps codes added by a
+// newer libdrop out of the known cases.
+func (c StatusCode) Known() StatusCode {
+	if !c.IsKnown() {
+		return StatusCodeUnknown
+	}
+	return c
+}
+
+// Returns the code as sent by libdrop
+func (c StatusCode) RawCode() int32 {
+	return int32(c)
+}
+
+// Returns the status code as sent by libdrop, also for codes the bindings
+// don't know
+func (s Status) RawCode() int32 {
+	return s.Status.RawCode()
+}
+
+// Returns the sentinel `ErrStatusCode*` of the code, `ErrStatusCodeUnknown`
+// for unknown codes
+func (c StatusCode) Err() error {
+	if err, ok := statusCodeErrors[c]; ok {
+		return err
+	}
+	return ErrStatusCodeUnknown
+}
+
+func (s Status) Error() string {
+	msg := fmt.Sprintf("%s: %s", s.Status, s.Status.Message())
+	if errno, ok := s.Errno(); ok {
+		msg += fmt.Sprintf(" (os error %d: %s)", *s.OsErrorCode, errno)
+	}
+	return msg
+}
+
+// Returns the OS error number as `syscall.Errno`, false if the status
+// carries none
+func (s Status) Errno() (syscall.Errno, bool) {
+	if s.OsErrorCode == nil || *s.OsErrorCode <= 0 {
+		return 0, false
+	}
+	return syscall.Errno(*s.OsErrorCode), true
+}
+
+// Returns the OS error as `syscall.Errno`, so that `errors.Is()` matches
+// `fs.ErrPermission`, `fs.ErrNotExist`, `syscall.ENOSPC` and alike
+func (s Status) Unwrap() error {
+	if errno, ok := s.Errno(); ok {
+		return errno
+	}
+	return nil
+}
+
+// Matches the sentinel `ErrStatusCode*` of the status code.
+// `StatusCodePermissionDenied` also matches `fs.ErrPermission` when no OS
+// error is attached.
+func (s Status) Is(target error) bool {
+	if target == fs.ErrPermission && s.Status == StatusCodePermissionDenied {
+		return true
+	}
+	return target == s.Status.Err()
+}
+
+// Returns the failure reported by an event as an error: the `Status` of
+// `EventKindFileFailed`, `EventKindTransferFailed` and
+// `EventKindTransferDeferred`, and the status code of
+// `EventKindRuntimeError`. Other events return `nil`.
+func EventError(kind EventKind) error {
+	switch k := kind.(type) {
+	case EventKindFileFailed:
+		return k.Status
+	case EventKindTransferFailed:
+		return k.Status
+	case EventKindTransferDeferred:
+		return k.Status
+	case EventKindRuntimeError:
+		return Status{Status: k.Status}
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,63 @@
+package norddrop
+
+import (
+	"errors"
+	"io/fs"
+	"syscall"
+	"testing"
+)
+
+func TestStatusCodeUnknown(t *testing.T) {
+	code := StatusCode(99)
+	if code.IsKnown() || code.Known() != StatusCodeUnknown {
+		t.Errorf("code %d treated as known", code)
+	}
+	if got := code.RawCode(); got != 99 {
+		t.Errorf("RawCode() = %d, want 99", got)
+	}
+	if got := code.String(); got != "StatusCode(99)" {
+		t.Errorf("String() = %q", got)
+	}
+	if code.Class() != StatusClassFatal {
+		t.Errorf("Class() = %s, want fatal", code.Class())
+	}
+
+	status := Status{Status: code}
+	if status.RawCode() != 99 {
+		t.Errorf("Status.RawCode() = %d, want 99", status.RawCode())
+	}
+	if !errors.Is(status, ErrStatusCodeUnknown) {
+		t.Errorf("%v does not match ErrStatusCodeUnknown", status)
+	}
+
+	if StatusCodeBadPath.Known() != StatusCodeBadPath || errors.Is(Status{Status: StatusCodeBadPath}, ErrStatusCodeUnknown) {
+		t.Error("known code treated as unknown")
+	}
+}
+
+func TestStatusErrno(t *testing.T) {
+	code := func(c int32) *int32 { return &c }
+
+	tests := []struct {
+		status Status
+		target error
+	}{
+		{Status{Status: StatusCodeIoError, OsErrorCode: code(int32(syscall.ENOSPC))}, syscall.ENOSPC},
+		{Status{Status: StatusCodeIoError, OsErrorCode: code(int32(syscall.EACCES))}, fs.ErrPermission},
+		{Status{Status: StatusCodeBadPath, OsErrorCode: code(int32(syscall.ENOENT))}, fs.ErrNotExist},
+		{Status{Status: StatusCodePermissionDenied}, fs.ErrPermission},
+		{Status{Status: StatusCodeIoError}, ErrStatusCodeIoError},
+	}
+	for _, tt := range tests {
+		if err := EventError(EventKindFileFailed{Status: tt.status}); !errors.Is(err, tt.target) {
+			t.Errorf("%v does not match %v", err, tt.target)
+		}
+	}
+
+	if _, ok := (Status{Status: StatusCodeIoError}).Errno(); ok {
+		t.Error("Errno() reported for a status without OS error")
+	}
+	if err := EventError(EventKindFileStarted{}); err != nil {
+		t.Errorf("EventError() = %v for a non failure event", err)
+	}
+}
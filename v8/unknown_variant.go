@@ -0,0 +1,79 @@
+package norddrop
+
+import (
+	"fmt"
+	"io"
+)
+
+// Err* are used for checking error type with `errors.Is`
+var ErrUnknownVariant = fmt.Errorf("UnknownVariant")
+var ErrLibdropErrorUnrecognized = fmt.Errorf("LibdropErrorUnrecognized")
+
+// Event kind added by a newer libdrop than the bindings know. `Data` holds
+// the undecoded fields following the tag.
+type EventKindUnknown struct {
+	Tag  int32
+	Data []byte
+}
+
+func (e EventKindUnknown) Destroy() {}
+
+// Error added by a newer libdrop than the bindings know, `Kind()` returns the
+// raw error code
+type LibdropErrorUnrecognized struct {
+	code    uint32
+	message string
+}
+
+func (err LibdropErrorUnrecognized) Error() string {
+	return fmt.Sprintf("Unrecognized(%d): %s", err.code, err.message)
+}
+
+func (self LibdropErrorUnrecognized) Is(target error) bool {
+	return target == ErrLibdropErrorUnrecognized
+}
+
+func (err LibdropErrorUnrecognized) Message() string { return err.message }
+
+// Enum variant the bindings can't decode because the length of its fields
+// is unknown. The rest of the buffer is lost, so decoding the whole value
+// fails.
+type UnknownVariantError struct {
+	// Go type of the enum, e.g. `TransferStateKind`
+	Type string
+	Tag  int32
+}
+
+func (e *UnknownVariantError) Error() string {
+	return fmt.Sprintf("unknown %s variant %d, libdrop is newer than the bindings", e.Type, e.Tag)
+}
+
+func (e *UnknownVariantError) Is(target error) bool {
+	return target == ErrUnknownVariant
+}
+
+// Decodes a value lifted from libdrop, returning `*UnknownVariantError`
+// instead of panicking when it contains an enum variant the bindings don't
+// know
+func liftKnownVariants[T any](lift func() T) (value T, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			unknown, ok := r.(*UnknownVariantError)
+			if !ok {
+				panic(r)
+			}
+			err = unknown
+		}
+	}()
+	return lift(), nil
+}
+
+// Reads the fields of an unknown variant, which must be the last value of
+// the buffer
+func readRemaining(reader io.Reader) []byte {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}